@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ito-org/go-backend/tcn"
+)
+
+const invalidOriginError = "Invalid origin"
+
+// adminSignedReport is the JSON representation of a stored signed report in
+// the admin API, which unlike the public one contains the metadata.
+type adminSignedReport struct {
+	ID     uint64      `json:"id"`
+	Report *tcn.Report `json:"report"`
+	Sig    []byte      `json:"sig"`
+	reportMetadata
+}
+
+// getAdminTCNReports lists signed reports together with their metadata. The
+// 'after' query param is the cursor of the last report of the previous page
+// and 'limit' the page size. Besides the filters of getTCNReport, 'origin'
+// restricts the result to reports with the given origins.
+func (h *TCNReportHandler) getAdminTCNReports(c *gin.Context) {
+	filter, err := parseReportFilter(c, h.configFor(c))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.Origins, err = parseOrigins(c.QueryArray("origin"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cursor, limit, _, err := parsePage(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	signedReports, err := h.dbConn.getSignedReportsAfter(cursor, limit, filter)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	nextCursor := cursor
+	if len(signedReports) > 0 {
+		nextCursor = signedReports[len(signedReports)-1].ID
+	}
+	adminSignedReports := make([]*adminSignedReport, len(signedReports))
+	for i, sr := range signedReports {
+		adminSignedReports[i] = &adminSignedReport{
+			ID:             sr.ID,
+			Report:         sr.Report,
+			Sig:            sr.Sig,
+			reportMetadata: sr.Metadata,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"signed_reports": adminSignedReports,
+		"next_cursor":    nextCursor,
+	})
+}
+
+// parseOrigins parses the given comma separated lists of report origins.
+func parseOrigins(params []string) ([]reportOrigin, error) {
+	origins := []reportOrigin{}
+	for _, param := range params {
+		for _, s := range strings.Split(param, ",") {
+			origin := reportOrigin(strings.TrimSpace(s))
+			if !origin.valid() {
+				return nil, errors.New(invalidOriginError)
+			}
+			origins = append(origins, origin)
+		}
+	}
+	return origins, nil
+}
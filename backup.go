@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/ito-org/go-backend/tcn"
+)
+
+const (
+	// exportFormat identifies export files in their manifest.
+	exportFormat = "tcn-signed-reports"
+	// exportVersion is the version of the export format. Version 1 manifests
+	// don't contain the receive times of the reports, version 2 manifests
+	// don't contain their regions and origins.
+	exportVersion = 3
+	// manifestSuffix is appended to the name of an export file to get the
+	// name of its manifest.
+	manifestSuffix = ".manifest.json"
+
+	checksumMismatchError = "Checksum of export file doesn't match its manifest"
+	unknownFormatError    = "Unknown export format"
+	invalidManifestError  = "Manifest doesn't contain the metadata of every report"
+)
+
+// exportManifest describes an export file. It's stored next to the file.
+type exportManifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Gzip      bool      `json:"gzip"`
+	// Count is the number of signed reports in the file and MemoTypes the
+	// number per memo type.
+	Count     int            `json:"count"`
+	MemoTypes map[string]int `json:"memo_types"`
+	// SHA256 is the hex encoded checksum of the file as stored, i.e. after
+	// compression.
+	SHA256 string `json:"sha256"`
+	// ReceivedAt are the times at which the exporting server received the
+	// signed reports, in unix seconds and in the order of the file.
+	ReceivedAt []int64 `json:"received_at"`
+	// Regions and Origins are the regions the signed reports were uploaded
+	// for (empty if none) and how they reached the exporting server, in the
+	// order of the file.
+	Regions []string       `json:"regions"`
+	Origins []reportOrigin `json:"origins"`
+}
+
+// reportExporter writes signed reports in the TCN wire format, optionally
+// gzipped, and records the manifest of the written data.
+type reportExporter struct {
+	hash     hash.Hash
+	gz       *gzip.Writer
+	enc      *tcn.Encoder
+	manifest *exportManifest
+}
+
+// newReportExporter returns an exporter writing to w. Close must be called
+// to complete the data.
+func newReportExporter(w io.Writer, compress bool) *reportExporter {
+	e := &reportExporter{
+		hash: sha256.New(),
+		manifest: &exportManifest{
+			Format:     exportFormat,
+			Version:    exportVersion,
+			CreatedAt:  time.Now().UTC(),
+			Gzip:       compress,
+			MemoTypes:  map[string]int{},
+			ReceivedAt: []int64{},
+			Regions:    []string{},
+			Origins:    []reportOrigin{},
+		},
+	}
+	w = io.MultiWriter(w, e.hash)
+	if compress {
+		e.gz = gzip.NewWriter(w)
+		w = e.gz
+	}
+	e.enc = tcn.NewEncoder(w)
+	return e
+}
+
+// Write writes sr and records the receive time, region and origin of meta in
+// the manifest.
+func (e *reportExporter) Write(sr *tcn.SignedReport, meta reportMetadata) error {
+	if err := e.enc.Encode(sr); err != nil {
+		return err
+	}
+	e.manifest.Count++
+	e.manifest.MemoTypes[fmt.Sprintf("0x%x", sr.Report.Memo.Type)]++
+	e.manifest.ReceivedAt = append(e.manifest.ReceivedAt, meta.ReceivedAt.Unix())
+	e.manifest.Regions = append(e.manifest.Regions, meta.Region)
+	e.manifest.Origins = append(e.manifest.Origins, meta.Origin)
+	return nil
+}
+
+// Close flushes the written data and returns its manifest. It doesn't close
+// the underlying writer.
+func (e *reportExporter) Close() (*exportManifest, error) {
+	if e.gz != nil {
+		if err := e.gz.Close(); err != nil {
+			return nil, err
+		}
+	}
+	e.manifest.SHA256 = hex.EncodeToString(e.hash.Sum(nil))
+	return e.manifest, nil
+}
+
+// exportSignedReports writes all signed reports of the tenant to w.
+func (db *DBConnection) exportSignedReports(w io.Writer, tenantID string, compress bool) (*exportManifest, error) {
+	e := newReportExporter(w, compress)
+	filter := &reportFilter{TenantID: tenantID}
+	var cursor uint64
+	for {
+		signedReports, err := db.getSignedReportsAfter(cursor, maxListLimit, filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(signedReports) == 0 {
+			break
+		}
+		for _, sr := range signedReports {
+			if err := e.Write(sr.SignedReport, sr.Metadata); err != nil {
+				return nil, err
+			}
+			cursor = sr.ID
+		}
+	}
+
+	manifest, err := e.Close()
+	if err != nil {
+		return nil, err
+	}
+	manifest.Tenant = tenantID
+	return manifest, nil
+}
+
+// exportFile writes the signed reports of the tenant to path and the
+// manifest next to it.
+func (db *DBConnection) exportFile(path, tenantID string, compress bool) (*exportManifest, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	manifest, err := db.exportSignedReports(w, tenantID, compress)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path+manifestSuffix, data, 0644); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// readManifest reads the manifest of the export file at path. It returns nil
+// if there's none.
+func readManifest(path string) (*exportManifest, error) {
+	data, err := ioutil.ReadFile(path + manifestSuffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	manifest := &exportManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("Failed to parse manifest: %s", err.Error())
+	}
+	if manifest.Format != exportFormat || manifest.Version < 1 || manifest.Version > exportVersion {
+		return nil, errors.New(unknownFormatError)
+	}
+	if manifest.Version > 1 && len(manifest.ReceivedAt) != manifest.Count {
+		return nil, errors.New(invalidManifestError)
+	}
+	if manifest.Version > 2 {
+		if len(manifest.Regions) != manifest.Count || len(manifest.Origins) != manifest.Count {
+			return nil, errors.New(invalidManifestError)
+		}
+		for _, origin := range manifest.Origins {
+			if !origin.valid() {
+				return nil, errors.New(invalidOriginError)
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// verifyChecksum returns an error if the data of r doesn't match the
+// checksum of manifest.
+func verifyChecksum(r io.Reader, manifest *exportManifest) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != manifest.SHA256 {
+		return errors.New(checksumMismatchError)
+	}
+	return nil
+}
+
+// importResult counts what happened to the signed reports of an import.
+type importResult struct {
+	Imported   int `json:"imported"`
+	Duplicates int `json:"duplicates"`
+	Invalid    int `json:"invalid"`
+}
+
+// importedReport is a signed report read from an export file.
+type importedReport struct {
+	*tcn.SignedReport
+	// ReceivedAt is the time the exporting server received the report. It's
+	// zero if the export file doesn't tell.
+	ReceivedAt time.Time
+	// Region is the region the report was uploaded for, if any, and Origin
+	// how it reached the exporting server. Origin is empty if the export
+	// file doesn't tell.
+	Region string
+	Origin reportOrigin
+}
+
+// readExport calls store with batches of at most maxBatchSize valid signed
+// reports read from r. The reports are validated like uploads with config,
+// including their regions; invalid reports are counted in the result and
+// skipped. The metadata of the reports is taken from manifest, which may be
+// nil.
+func readExport(r io.Reader, compress bool, manifest *exportManifest, config *Config, store func([]*importedReport) error) (*importResult, error) {
+	if manifest == nil {
+		manifest = &exportManifest{}
+	}
+	if compress {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	result := &importResult{}
+	dec := tcn.NewDecoder(r)
+	batch := make([]*importedReport, 0, maxBatchSize)
+	for i := 0; ; i++ {
+		sr := &tcn.SignedReport{}
+		err := dec.Decode(sr)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		report := &importedReport{SignedReport: sr}
+		if i < len(manifest.ReceivedAt) {
+			report.ReceivedAt = time.Unix(manifest.ReceivedAt[i], 0).UTC()
+		}
+		if i < len(manifest.Regions) {
+			report.Region = manifest.Regions[i]
+		}
+		if i < len(manifest.Origins) {
+			report.Origin = manifest.Origins[i]
+		}
+
+		if err := validateSignedReport(config, sr); err != nil {
+			result.Invalid++
+			continue
+		}
+		if report.Region != "" && !config.acceptsRegion(report.Region) {
+			result.Invalid++
+			continue
+		}
+		batch = append(batch, report)
+		if len(batch) == maxBatchSize {
+			if err := store(batch); err != nil {
+				return nil, err
+			}
+			batch = make([]*importedReport, 0, maxBatchSize)
+		}
+	}
+	if len(batch) > 0 {
+		if err := store(batch); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// importFile stores the signed reports of the export file at path for the
+// tenant of config. If the file has a manifest, its checksum is verified
+// before anything is imported and it determines whether the file is gzipped
+// and when, for which region and how the reports were received. Otherwise
+// compress does and the reports are stored as received now with origin
+// import. Signed reports that are already stored for the
+// tenant or that the tenant wouldn't accept as uploads are skipped.
+func (db *DBConnection) importFile(path string, config *Config, compress bool) (*importResult, error) {
+	manifest, err := readManifest(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if manifest != nil {
+		if err := verifyChecksum(f, manifest); err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		compress = manifest.Gzip
+	}
+
+	meta := reportMetadata{Origin: originImport, TenantID: config.TenantID}
+	var imported, duplicates int
+	result, err := readExport(bufio.NewReader(f), compress, manifest, config, func(srs []*importedReport) error {
+		n, err := db.importSignedReports(srs, meta)
+		imported += n
+		duplicates += len(srs) - n
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Imported = imported
+	result.Duplicates = duplicates
+	return result, nil
+}
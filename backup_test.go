@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportRoundTrip(t *testing.T) {
+	signedReports := generateSignedReports(t, 3)
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	regions := []string{"by", "", "bw"}
+	origins := []reportOrigin{originUpload, originFederation, originSeed}
+	config := DefaultConfig()
+	config.Regions = []string{"by", "bw"}
+
+	for _, compress := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		e := newReportExporter(buf, compress)
+		for i, sr := range signedReports {
+			meta := reportMetadata{
+				ReceivedAt: start.Add(time.Duration(i) * time.Hour),
+				Region:     regions[i],
+				Origin:     origins[i],
+			}
+			if err := e.Write(sr, meta); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		manifest, err := e.Close()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, exportFormat, manifest.Format)
+		assert.Equal(t, compress, manifest.Gzip)
+		assert.Equal(t, 3, manifest.Count)
+		assert.Equal(t, map[string]int{"0x2": 3}, manifest.MemoTypes)
+		assert.Equal(t, []int64{start.Unix(), start.Unix() + 3600, start.Unix() + 7200}, manifest.ReceivedAt)
+		assert.Equal(t, regions, manifest.Regions)
+		assert.Equal(t, origins, manifest.Origins)
+		assert.NoError(t, verifyChecksum(bytes.NewReader(buf.Bytes()), manifest))
+
+		if !compress {
+			expected := []byte{}
+			for _, sr := range signedReports {
+				expected, _ = sr.AppendBytes(expected)
+			}
+			assert.Equal(t, expected, buf.Bytes())
+		}
+
+		imported := []*importedReport{}
+		result, err := readExport(bytes.NewReader(buf.Bytes()), compress, manifest, config, func(srs []*importedReport) error {
+			imported = append(imported, srs...)
+			return nil
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, 0, result.Invalid)
+		assert.Equal(t, len(signedReports), len(imported))
+		for i, sr := range imported {
+			assert.Equal(t, signedReports[i], sr.SignedReport)
+			assert.True(t, start.Add(time.Duration(i)*time.Hour).Equal(sr.ReceivedAt))
+			assert.Equal(t, regions[i], sr.Region)
+			assert.Equal(t, origins[i], sr.Origin)
+		}
+
+		data := buf.Bytes()
+		data[len(data)-1] ^= 0xff
+		assert.EqualError(t, verifyChecksum(bytes.NewReader(data), manifest), checksumMismatchError)
+	}
+}
+
+func TestReadExportInvalid(t *testing.T) {
+	signedReports := generateSignedReports(t, 3)
+	signedReports[0].Sig[0] ^= 0xff
+
+	// Reports that wouldn't be accepted as uploads are invalid as well.
+	signedReports = append(signedReports, generateSignedReportRange(t, 1, defaultMaxKeySpan+2))
+
+	data := []byte{}
+	for _, sr := range signedReports {
+		data, _ = sr.AppendBytes(data)
+	}
+	manifest := &exportManifest{
+		ReceivedAt: []int64{1, 2, 3, 4},
+		Regions:    []string{"", "", "", ""},
+		Origins:    []reportOrigin{originUpload, originUpload, originFederation, originUpload},
+	}
+
+	imported := []*importedReport{}
+	result, err := readExport(bytes.NewReader(data), false, manifest, DefaultConfig(), func(srs []*importedReport) error {
+		imported = append(imported, srs...)
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, 2, result.Invalid)
+	assert.Equal(t, []*importedReport{
+		{SignedReport: signedReports[1], ReceivedAt: time.Unix(2, 0).UTC(), Origin: originUpload},
+		{SignedReport: signedReports[2], ReceivedAt: time.Unix(3, 0).UTC(), Origin: originFederation},
+	}, imported)
+
+	// Tenants only import the regions they accept.
+	manifest.Regions = []string{"", "by", "be", ""}
+	config := DefaultConfig()
+	config.Regions = []string{"by"}
+	imported = imported[:0]
+	result, err = readExport(bytes.NewReader(data), false, manifest, config, func(srs []*importedReport) error {
+		imported = append(imported, srs...)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Invalid)
+	assert.Len(t, imported, 1)
+	assert.Equal(t, "by", imported[0].Region)
+
+	// Tenants only import the memo types they accept.
+	config = DefaultConfig()
+	config.MemoTypes = []uint8{tcn.CoEpiMemoCode}
+	result, err = readExport(bytes.NewReader(data), false, nil, config, func([]*importedReport) error {
+		t.Error("No report should be imported")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, len(signedReports), result.Invalid)
+
+	// Truncated files are rejected.
+	_, err = readExport(bytes.NewReader(data[:len(data)-1]), false, nil, DefaultConfig(), func([]*importedReport) error {
+		return nil
+	})
+	assert.Error(t, err)
+}
+
+func TestExportImportFile(t *testing.T) {
+	config := DefaultConfig()
+	config.TenantID = "export-test"
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "reports.tcn.gz")
+
+	receivedAt := time.Now().Add(-24 * time.Hour).Truncate(time.Second).UTC()
+	imports := []*importedReport{}
+	for _, sr := range generateSignedReports(t, 2) {
+		imports = append(imports, &importedReport{SignedReport: sr, ReceivedAt: receivedAt})
+	}
+	n, err := handler.dbConn.importSignedReports(imports, reportMetadata{Origin: originImport, TenantID: config.TenantID})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, 2, n)
+
+	manifest, err := handler.dbConn.exportFile(path, config.TenantID, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.True(t, manifest.Count >= 2)
+	assert.Equal(t, config.TenantID, manifest.Tenant)
+	assert.Contains(t, manifest.ReceivedAt, receivedAt.Unix())
+
+	// Importing into the same tenant only finds duplicates.
+	result, err := handler.dbConn.importFile(path, config, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, importResult{Duplicates: manifest.Count}, *result)
+
+	// Importing into another tenant keeps the receive times.
+	other := DefaultConfig()
+	other.TenantID = "import-test-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	result, err = handler.dbConn.importFile(path, other, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, importResult{Imported: manifest.Count}, *result)
+	stored, err := handler.dbConn.getSignedReports(&reportFilter{TenantID: other.TenantID})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, manifest.Count, len(stored))
+	for _, sr := range stored {
+		assert.Contains(t, manifest.ReceivedAt, sr.Metadata.ReceivedAt.Unix())
+		assert.Contains(t, manifest.Regions, sr.Metadata.Region)
+		assert.Contains(t, manifest.Origins, sr.Metadata.Origin)
+	}
+
+	readManifestFile, err := readManifest(path)
+	assert.NoError(t, err)
+	assert.Equal(t, manifest.SHA256, readManifestFile.SHA256)
+
+	// Files that don't match their manifest aren't imported.
+	if err := ioutil.WriteFile(path, []byte("corrupt"), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = handler.dbConn.importFile(path, config, false)
+	assert.EqualError(t, err, checksumMismatchError)
+}
+
+func TestImportDelivery(t *testing.T) {
+	meta := reportMetadata{Origin: originUpload, TenantID: "import-delivery-test-" + strconv.FormatInt(time.Now().UnixNano(), 10)}
+	filter := &reportFilter{TenantID: meta.TenantID}
+
+	// A poller has seen the latest report and remembers it, its cursor and
+	// the time it was stored.
+	last := generateSignedReport(t)
+	if err := handler.dbConn.insertSignedReport(last, meta); err != nil {
+		t.Error(err)
+		return
+	}
+	srs, err := handler.dbConn.getSignedReports(filter)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, srs, 1)
+	cursor := srs[0].ID
+	since := srs[0].Metadata.StoredAt
+
+	// The imported report was received long before.
+	imported := generateSignedReport(t)
+	receivedAt := since.Add(-48 * time.Hour).Truncate(time.Second)
+	n, err := handler.dbConn.importSignedReports([]*importedReport{
+		{SignedReport: imported, ReceivedAt: receivedAt},
+	}, reportMetadata{Origin: originImport, TenantID: meta.TenantID})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, 1, n)
+
+	assertImported := func(srs []*storedSignedReport) {
+		t.Helper()
+		found := false
+		for _, sr := range srs {
+			if reflect.DeepEqual(imported, sr.SignedReport) {
+				found = true
+				assert.True(t, receivedAt.Equal(sr.Metadata.ReceivedAt))
+				assert.False(t, sr.Metadata.StoredAt.Before(since))
+			}
+		}
+		assert.True(t, found)
+	}
+
+	srs, err = handler.dbConn.getSignedReports(&reportFilter{TenantID: meta.TenantID, StoredAfter: since})
+	assert.NoError(t, err)
+	assertImported(srs)
+
+	srs, err = handler.dbConn.getNewSignedReports(last.Report, filter)
+	assert.NoError(t, err)
+	assertImported(srs)
+
+	srs, err = handler.dbConn.getSignedReportsAfter(cursor, maxListLimit, filter)
+	assert.NoError(t, err)
+	assertImported(srs)
+
+	// Filtering by receive time still finds the original time.
+	srs, err = handler.dbConn.getSignedReports(&reportFilter{TenantID: meta.TenantID, ReceivedAfter: since})
+	assert.NoError(t, err)
+	for _, sr := range srs {
+		assert.NotEqual(t, imported, sr.SignedReport)
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "reports.tcn")
+
+	for _, tc := range []struct {
+		manifest string
+		err      string
+	}{
+		{`{"format": "tcn-signed-reports", "version": 1, "count": 1}`, ""},
+		{`{"format": "tcn-signed-reports", "version": 2, "count": 1, "received_at": [1]}`, ""},
+		{`{"format": "tcn-signed-reports", "version": 3, "count": 1, "received_at": [1], "regions": [""], "origins": ["upload"]}`, ""},
+		{`{"format": "tcn-signed-reports", "version": 2, "count": 1}`, invalidManifestError},
+		{`{"format": "tcn-signed-reports", "version": 3, "count": 1, "received_at": [1]}`, invalidManifestError},
+		{`{"format": "tcn-signed-reports", "version": 3, "count": 1, "received_at": [1], "regions": [""], "origins": ["other"]}`, invalidOriginError},
+		{`{"format": "tcn-signed-reports", "version": 4, "count": 0}`, unknownFormatError},
+	} {
+		if err := ioutil.WriteFile(path+manifestSuffix, []byte(tc.manifest), 0644); err != nil {
+			t.Error(err)
+			return
+		}
+		_, err := readManifest(path)
+		if tc.err == "" {
+			assert.NoError(t, err, tc.manifest)
+		} else {
+			assert.EqualError(t, err, tc.err, tc.manifest)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ito-org/go-backend/tcn"
+)
+
+// Config holds the settings that define which reports the server accepts
+// and returns. With several tenants, every tenant has its own Config.
+type Config struct {
+	// TenantID identifies the tenant the settings belong to. It's empty for
+	// the default tenant.
+	TenantID string
+
+	// MemoTypes are the memo types accepted for upload.
+	MemoTypes []uint8
+	// MaxKeySpan is the maximum number of keys a report may cover (j2 - j1).
+	MaxKeySpan uint16
+	// Retention is the time reports are served for after they were received.
+	// Earlier 'since' timestamps are clamped to the start of the window. Zero
+	// disables clamping.
+	Retention time.Duration
+	// PaddingBucketSize is the size upload responses are padded to a
+	// multiple of. Zero disables padding.
+	PaddingBucketSize int
+
+	// LogIPMode defines how client IPs are logged: "none", "truncated" or
+	// "hashed".
+	LogIPMode string
+	// LogFormat is the format of the request log: "text" or "json".
+	LogFormat string
+
+	// Regions are the regions reports may be uploaded for. Uploads without
+	// region are always accepted.
+	Regions []string
+
+	// StatsEpsilon is the privacy budget spent on the statistics of a day.
+	StatsEpsilon float64
+
+	// ClientCertSubjects are the subject common names of the client
+	// certificates accepted by the federation and admin routes of a tenant.
+	// The default tenant accepts every certificate signed by the client CA.
+	ClientCertSubjects []string
+
+	// VerificationIssuers are the public keys of the issuers of verification
+	// tokens. If there are any, verified test reports must contain a token
+	// signed by one of them (see validateVerificationToken).
+	VerificationIssuers []ed25519.PublicKey
+	// SigningKey signs report downloads, so that clients can check that they
+	// come from the health authority. Downloads aren't signed if it's nil.
+	SigningKey ed25519.PrivateKey
+}
+
+// defaultMaxKeySpan allows reports covering 14 days of TCNs rotated every
+// 15 minutes.
+const defaultMaxKeySpan = 14 * 24 * 4
+
+// defaultRetention matches the 14 days of TCNs covered by defaultMaxKeySpan.
+const defaultRetention = 14 * 24 * time.Hour
+
+// defaultPaddingBucketSize is larger than the responses to single report
+// uploads, so that they are all padded to the same size.
+const defaultPaddingBucketSize = 256
+
+// DefaultConfig returns the configuration used if no settings are given.
+func DefaultConfig() *Config {
+	return &Config{
+		MemoTypes:  []uint8{tcn.ITOMemoCode},
+		MaxKeySpan: defaultMaxKeySpan,
+		Retention:  defaultRetention,
+
+		PaddingBucketSize: defaultPaddingBucketSize,
+
+		LogIPMode: logIPNone,
+		LogFormat: logFormatText,
+
+		StatsEpsilon: defaultStatsEpsilon,
+	}
+}
+
+// acceptsMemoType returns whether reports with memo type t may be uploaded.
+func (cfg *Config) acceptsMemoType(t uint8) bool {
+	for _, mt := range cfg.MemoTypes {
+		if mt == t {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsRegion returns whether reports may be uploaded for region.
+func (cfg *Config) acceptsRegion(region string) bool {
+	for _, r := range cfg.Regions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsClientCert returns whether a client with the verified certificate
+// chains may use the federation and admin routes of the tenant.
+func (cfg *Config) acceptsClientCert(chains [][]*x509.Certificate) bool {
+	if cfg.TenantID == "" {
+		return len(chains) > 0
+	}
+	for _, chain := range chains {
+		if len(chain) == 0 {
+			continue
+		}
+		for _, subject := range cfg.ClientCertSubjects {
+			if chain[0].Subject.CommonName == subject {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// retentionStart returns the receive time of the oldest reports that are
+// still served at now.
+func (cfg *Config) retentionStart(now time.Time) time.Time {
+	return now.Add(-cfg.Retention)
+}
+
+// parseMemoTypes parses memo type codes given as comma separated lists, e.g.
+// "0,2" or "0x0,0x2". All codes must be registered in package tcn.
+func parseMemoTypes(values []string) ([]uint8, error) {
+	memoTypes := []uint8{}
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			code, err := strconv.ParseUint(s, 0, 8)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid memo type: %s", s)
+			}
+			if _, ok := tcn.LookupMemoType(uint8(code)); !ok {
+				return nil, fmt.Errorf("Unknown memo type: %s", s)
+			}
+			memoTypes = append(memoTypes, uint8(code))
+		}
+	}
+	return memoTypes, nil
+}
+
+// parseRegions parses regions given as comma separated lists, e.g. "by,bw".
+func parseRegions(values []string) []string {
+	regions := []string{}
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				regions = append(regions, s)
+			}
+		}
+	}
+	return regions
+}
+
+// parseVerificationIssuers parses base64 encoded Ed25519 public keys given as
+// comma separated lists.
+func parseVerificationIssuers(values []string) ([]ed25519.PublicKey, error) {
+	issuers := []ed25519.PublicKey{}
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			key, err := base64.StdEncoding.DecodeString(s)
+			if err != nil || len(key) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("Invalid verification issuer: %s", s)
+			}
+			issuers = append(issuers, ed25519.PublicKey(key))
+		}
+	}
+	return issuers, nil
+}
+
+// readSigningKey reads the base64 encoded Ed25519 seed of a signing key from
+// the file at path.
+func readSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("Invalid signing key in %s", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
@@ -1,21 +1,76 @@
 package main
 
 import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/ito-org/go-backend/tcn"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// reportFeedLockID is the key of the Postgres advisory lock that is held by
+// all transactions storing signed reports.
+const reportFeedLockID = 0x74636e
+
+// DBTLSSettings holds the TLS settings for the database connection. The
+// fields map to the sslmode, sslrootcert, sslcert and sslkey connection
+// parameters of lib/pq.
+type DBTLSSettings struct {
+	Mode     string
+	RootCert string
+	Cert     string
+	Key      string
+}
+
+// connParams returns the TLS part of the connection string.
+func (s *DBTLSSettings) connParams() (string, error) {
+	if s == nil || s.Mode == "" {
+		return "sslmode=disable", nil
+	}
+
+	switch s.Mode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		return "", fmt.Errorf("Unsupported Postgres sslmode: %s", s.Mode)
+	}
+	if (s.Mode == "verify-ca" || s.Mode == "verify-full") && s.RootCert == "" {
+		return "", errors.New("Postgres sslmode " + s.Mode + " requires a root certificate")
+	}
+
+	params := "sslmode=" + s.Mode
+	if s.RootCert != "" {
+		params += " sslrootcert=" + s.RootCert
+	}
+	if s.Cert != "" {
+		params += " sslcert=" + s.Cert
+	}
+	if s.Key != "" {
+		params += " sslkey=" + s.Key
+	}
+	return params, nil
+}
+
 // NewDBConnection creates and tests a new db connection and returns it.
-func NewDBConnection(dbHost, dbUser, dbPassword, dbName string) (*DBConnection, error) {
+// tlsSettings may be nil, in which case TLS is disabled.
+func NewDBConnection(dbHost, dbUser, dbPassword, dbName string, tlsSettings *DBTLSSettings) (*DBConnection, error) {
+	tlsParams, err := tlsSettings.connParams()
+	if err != nil {
+		return nil, err
+	}
+
 	connStr := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s sslmode=disable",
+		"host=%s user=%s password=%s dbname=%s %s",
 		dbHost,
 		dbUser,
 		dbPassword,
 		dbName,
+		tlsParams,
 	)
 
 	db, err := sqlx.Connect("postgres", connStr)
@@ -23,27 +78,41 @@ func NewDBConnection(dbHost, dbUser, dbPassword, dbName string) (*DBConnection,
 		fmt.Printf("Failed to connect to Postgres database: %s\n", err.Error())
 		return nil, err
 	}
-	return &DBConnection{db}, err
+	return &DBConnection{
+		DB:      db,
+		connStr: connStr,
+		hub:     newReportHub(),
+	}, err
 }
 
 // DBConnection implements several functions for fetching and manipulation
 // of reports in the database.
 type DBConnection struct {
 	*sqlx.DB
+	connStr string
+
+	// hub receives all signed reports after they have been stored. If notify
+	// is set, stored reports are announced through Postgres NOTIFY first.
+	hub    *reportHub
+	notify bool
+	// announceMu makes reports get published to hub in the order in which
+	// they were committed.
+	announceMu sync.Mutex
 }
 
-func (db *DBConnection) insertMemo(memo *tcn.Memo) (uint64, error) {
+func insertMemo(q sqlx.Queryer, memo *tcn.Memo, tenantID string) (uint64, error) {
 	var newID uint64
-	if err := db.QueryRowx(
+	if err := q.QueryRowx(
 		`
 		INSERT INTO
-		Memo(mtype, mlen, mdata)
-		VALUES($1, $2, $3)
+		Memo(mtype, mlen, mdata, tenant_id)
+		VALUES($1, $2, $3, $4)
 		RETURNING id;
 		`,
 		memo.Type,
 		memo.Len,
 		memo.Data[:],
+		tenantID,
 	).Scan(&newID); err != nil {
 		fmt.Printf("Failed to insert memo into database: %s\n", err.Error())
 		return 0, err
@@ -51,67 +120,335 @@ func (db *DBConnection) insertMemo(memo *tcn.Memo) (uint64, error) {
 	return newID, nil
 }
 
-func (db *DBConnection) insertReport(report *tcn.Report) (uint64, error) {
-	memoID, err := db.insertMemo(report.Memo)
+// insertReport stores report and returns its ID and the time it was received.
+// The time is receivedAt if it isn't zero and the current time otherwise.
+func insertReport(q sqlx.Queryer, report *tcn.Report, tenantID string, receivedAt time.Time) (uint64, time.Time, error) {
+	memoID, err := insertMemo(q, report.Memo, tenantID)
 	if err != nil {
-		return 0, err
+		return 0, time.Time{}, err
 	}
 
 	var newID uint64
 
-	if err = db.QueryRowx(
+	if err = q.QueryRowx(
 		`
 	INSERT INTO
-	Report(rvk, tck_bytes, j_1, j_2, memo_id)
-	VALUES($1, $2, $3, $4, $5)
-	RETURNING id;
+	Report(rvk, tck_bytes, j_1, j_2, memo_id, tenant_id, timestamp)
+	VALUES($1, $2, $3, $4, $5, $6, COALESCE($7::timestamptz, current_timestamp))
+	RETURNING id, timestamp;
 	`,
 		report.RVK,
 		report.TCKBytes[:],
 		report.J1,
 		report.J2,
 		memoID,
-	).Scan(&newID); err != nil {
+		tenantID,
+		sql.NullTime{Time: receivedAt, Valid: !receivedAt.IsZero()},
+	).Scan(&newID, &receivedAt); err != nil {
 		fmt.Printf("Failed to insert report into database: %s\n", err.Error())
-		return 0, err
+		return 0, time.Time{}, err
 	}
-	return newID, nil
+	return newID, receivedAt, nil
 }
 
-func (db *DBConnection) insertSignedReport(signedReport *tcn.SignedReport) error {
-	reportID, err := db.insertReport(signedReport.Report)
+// signedReportHash identifies signedReport within a tenant. The signature
+// covers the whole report, so together with the RVK and TCK it's unique.
+func signedReportHash(signedReport *tcn.SignedReport) []byte {
+	h := sha256.New()
+	h.Write(signedReport.Report.RVK)
+	h.Write(signedReport.Report.TCKBytes[:])
+	h.Write(signedReport.Sig)
+	return h.Sum(nil)
+}
+
+// insertSignedReport stores signedReport with the origin, region and tenant
+// of meta. Reports are received now unless meta sets the time. It returns nil
+// if the report is already stored for the tenant.
+func insertSignedReport(q sqlx.Queryer, signedReport *tcn.SignedReport, meta reportMetadata) (*storedSignedReport, error) {
+	reportID, receivedAt, err := insertReport(q, signedReport.Report, meta.TenantID, meta.ReceivedAt)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = db.Exec(
+	meta.ReceivedAt = receivedAt
+	meta.Verification = verificationSignature
+	stored := &storedSignedReport{
+		SignedReport: signedReport,
+		Metadata:     meta,
+	}
+	if err = q.QueryRowx(
 		`
 		INSERT INTO
-		SignedReport(report_id, sig)
-		VALUES($1, $2)
+		SignedReport(report_id, sig, origin, verification, region, tenant_id, hash)
+		VALUES($1, $2, $3, $4, NULLIF($5, ''), $6, $7)
+		ON CONFLICT (tenant_id, hash) DO NOTHING
+		RETURNING id, stored_at;
 		`,
 		reportID,
 		signedReport.Sig[:],
-	)
-	if err != nil {
+		meta.Origin,
+		meta.Verification,
+		meta.Region,
+		meta.TenantID,
+		signedReportHash(signedReport),
+	).Scan(&stored.ID, &stored.Metadata.StoredAt); err == sql.ErrNoRows {
+		return nil, deleteReport(q, reportID)
+	} else if err != nil {
 		fmt.Printf("Failed to insert signed report into database: %s\n", err.Error())
+		return nil, err
+	}
+	return stored, nil
+}
+
+// deleteReport deletes the report with the given ID and its memo. It's used
+// to remove the rows inserted for a signed report that turned out to be a
+// duplicate.
+func deleteReport(q sqlx.Queryer, reportID uint64) error {
+	var memoID uint64
+	if err := q.QueryRowx(
+		`
+		WITH report AS (
+			DELETE FROM Report WHERE id = $1 RETURNING memo_id
+		)
+		DELETE FROM Memo m
+		USING report r
+		WHERE m.id = r.memo_id
+		RETURNING m.id;
+		`,
+		reportID,
+	).Scan(&memoID); err != nil {
+		fmt.Printf("Failed to delete report: %s\n", err.Error())
+		return err
+	}
+	return nil
+}
+
+// insertSignedReport stores a signed report with the origin, region and
+// tenant of meta.
+func (db *DBConnection) insertSignedReport(signedReport *tcn.SignedReport, meta reportMetadata) error {
+	return db.insertSignedReports([]*tcn.SignedReport{signedReport}, meta)
+}
+
+// insertSignedReports stores all signed reports in one transaction. The
+// reports are announced to followers after the transaction was committed.
+// Reports that are already stored are skipped. All reports must have been
+// verified by the caller.
+func (db *DBConnection) insertSignedReports(signedReports []*tcn.SignedReport, meta reportMetadata) error {
+	_, err := db.storeReports(func(tx *sqlx.Tx) ([]*storedSignedReport, error) {
+		stored := make([]*storedSignedReport, 0, len(signedReports))
+		for _, sr := range signedReports {
+			storedSR, err := insertSignedReport(tx, sr, meta)
+			if err != nil {
+				return nil, err
+			}
+			if storedSR != nil {
+				stored = append(stored, storedSR)
+			}
+		}
+		return stored, nil
+	})
+	return err
+}
+
+// insertDecoySignedReports looks up every report in a transaction like
+// insertSignedReports, so decoy uploads cause database work as well, but
+// doesn't insert anything. Inserting and rolling back would use up IDs, and
+// the gaps between the cursors of stored reports would reveal how many decoys
+// were sent.
+func (db *DBConnection) insertDecoySignedReports(signedReports []*tcn.SignedReport, meta reportMetadata) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		fmt.Printf("Failed to begin transaction: %s\n", err.Error())
+		return err
+	}
+	for _, sr := range signedReports {
+		if _, err := signedReportExists(tx, sr, meta.TenantID); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Rollback(); err != nil {
+		fmt.Printf("Failed to roll back transaction: %s\n", err.Error())
 		return err
 	}
 	return nil
 }
 
-func (db *DBConnection) scanSignedReports(rows *sqlx.Rows) ([]*tcn.SignedReport, error) {
-	signedReports := []*tcn.SignedReport{}
+// storeReports calls insert in a transaction and announces the signed reports
+// it returns once the transaction was committed.
+//
+// Signed report IDs are cursors, so a report must never become visible after
+// a report with a higher ID, or readers could already have moved their
+// cursors past it. IDs are assigned on insert but become visible on commit,
+// so all transactions storing reports hold an advisory lock until they are
+// committed. This makes them commit in the order of their IDs, also across
+// replicas. Reports are announced in the same order.
+func (db *DBConnection) storeReports(insert func(tx *sqlx.Tx) ([]*storedSignedReport, error)) ([]*storedSignedReport, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		fmt.Printf("Failed to begin transaction: %s\n", err.Error())
+		return nil, err
+	}
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1);`, reportFeedLockID); err != nil {
+		fmt.Printf("Failed to lock report feed: %s\n", err.Error())
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	stored, err := insert(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := db.notifySignedReports(tx, stored); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	db.announceMu.Lock()
+	defer db.announceMu.Unlock()
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Failed to commit transaction: %s\n", err.Error())
+		return nil, err
+	}
+	db.publishSignedReports(stored)
+	return stored, nil
+}
+
+// importSignedReports stores the signed reports that aren't stored for the
+// tenant of meta yet in one transaction and returns how many were stored.
+// Reports keep their receive time, region and origin if they are known. All
+// reports must have been verified by the caller.
+func (db *DBConnection) importSignedReports(signedReports []*importedReport, meta reportMetadata) (int, error) {
+	stored, err := db.storeReports(func(tx *sqlx.Tx) ([]*storedSignedReport, error) {
+		stored := make([]*storedSignedReport, 0, len(signedReports))
+		for _, sr := range signedReports {
+			m := meta
+			m.ReceivedAt = sr.ReceivedAt
+			m.Region = sr.Region
+			if sr.Origin != "" {
+				m.Origin = sr.Origin
+			}
+			storedSR, err := insertSignedReport(tx, sr.SignedReport, m)
+			if err != nil {
+				return nil, err
+			}
+			if storedSR != nil {
+				stored = append(stored, storedSR)
+			}
+		}
+		return stored, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(stored), nil
+}
+
+// signedReportExists returns whether signedReport is stored for the tenant.
+func signedReportExists(q sqlx.Queryer, signedReport *tcn.SignedReport, tenantID string) (bool, error) {
+	var exists bool
+	if err := q.QueryRowx(
+		`
+		SELECT EXISTS(
+			SELECT 1
+			FROM SignedReport
+			WHERE tenant_id = $1
+			AND hash = $2
+		);
+		`,
+		tenantID,
+		signedReportHash(signedReport),
+	).Scan(&exists); err != nil {
+		fmt.Printf("Failed to look up signed report: %s\n", err.Error())
+		return false, err
+	}
+	return exists, nil
+}
+
+// reportOrigin describes how a signed report reached the server.
+type reportOrigin string
+
+const (
+	// originUpload marks reports uploaded directly by clients.
+	originUpload reportOrigin = "upload"
+	// originFederation marks reports received from federation peers.
+	originFederation reportOrigin = "federation"
+	// originImport marks reports imported by an administrator.
+	originImport reportOrigin = "import"
+	// originSeed marks generated reports stored for development.
+	originSeed reportOrigin = "seed"
+)
+
+// valid returns whether o is one of the known origins.
+func (o reportOrigin) valid() bool {
+	switch o {
+	case originUpload, originFederation, originImport, originSeed:
+		return true
+	}
+	return false
+}
+
+// verificationSignature marks reports whose signature was verified by this
+// server. It's currently the only verification method.
+const verificationSignature = "signature"
+
+// reportMetadata is the information the server records about a signed
+// report in addition to the report itself.
+type reportMetadata struct {
+	ReceivedAt time.Time `json:"received_at"`
+	// StoredAt is the time the report was stored by this server. It's later
+	// than ReceivedAt for imported reports, which keep their receive time.
+	StoredAt     time.Time    `json:"stored_at"`
+	Origin       reportOrigin `json:"origin"`
+	Verification string       `json:"verification"`
+	// Region is the region the report was uploaded for, if any.
+	Region string `json:"region,omitempty"`
+	// TenantID is the tenant the report belongs to. It's empty for the
+	// default tenant and never returned to clients.
+	TenantID string `json:"-"`
+}
+
+// storedSignedReport is a signed report as stored in the database. The ID
+// defines the position of the signed report in the feed and is used as a
+// cursor.
+type storedSignedReport struct {
+	ID uint64
+	*tcn.SignedReport
+	Metadata reportMetadata
+}
+
+// MarshalJSON implements json.Marshaler. It adds the cursor to the JSON
+// representation of the signed report. The metadata is left out, because
+// receive times could link reports to the uploads that were observed on the
+// network; only the admin API returns it.
+func (sr *storedSignedReport) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		ID     uint64      `json:"id"`
+		Report *tcn.Report `json:"report"`
+		Sig    []byte      `json:"sig"`
+	}{
+		ID:     sr.ID,
+		Report: sr.Report,
+		Sig:    sr.Sig,
+	})
+}
+
+func (db *DBConnection) scanSignedReports(rows *sqlx.Rows) ([]*storedSignedReport, error) {
+	signedReports := []*storedSignedReport{}
 	for rows.Next() {
-		signedReport := &tcn.SignedReport{
-			Report: &tcn.Report{
-				TCKBytes: [32]uint8{},
-				Memo:     &tcn.Memo{},
+		signedReport := &storedSignedReport{
+			SignedReport: &tcn.SignedReport{
+				Report: &tcn.Report{
+					TCKBytes: [32]uint8{},
+					Memo:     &tcn.Memo{},
+				},
+				Sig: []byte{},
 			},
-			Sig: []byte{},
 		}
 		tckBytesDest := []byte{}
 		if err := rows.Scan(
+			&signedReport.ID,
 			&signedReport.Report.RVK,
 			&tckBytesDest,
 			&signedReport.Report.J1,
@@ -120,6 +457,12 @@ func (db *DBConnection) scanSignedReports(rows *sqlx.Rows) ([]*tcn.SignedReport,
 			&signedReport.Report.Memo.Len,
 			&signedReport.Report.Memo.Data,
 			&signedReport.Sig,
+			&signedReport.Metadata.ReceivedAt,
+			&signedReport.Metadata.StoredAt,
+			&signedReport.Metadata.Origin,
+			&signedReport.Metadata.Verification,
+			&signedReport.Metadata.Region,
+			&signedReport.Metadata.TenantID,
 		); err != nil {
 			fmt.Printf("Failed to scan signed report: %s\n", err.Error())
 			return nil, err
@@ -131,14 +474,139 @@ func (db *DBConnection) scanSignedReports(rows *sqlx.Rows) ([]*tcn.SignedReport,
 	return signedReports, nil
 }
 
-func (db *DBConnection) getSignedReports() ([]*tcn.SignedReport, error) {
+// reportFilter restricts which signed reports are returned from the
+// database. Empty fields don't restrict the result, except for TenantID:
+// queries only ever return the reports of one tenant.
+type reportFilter struct {
+	// TenantID is the tenant whose reports are returned. Empty is the
+	// default tenant.
+	TenantID  string
+	MemoTypes []uint8
+	// ReceivedAfter and ReceivedBefore restrict the result to reports
+	// received in [ReceivedAfter, ReceivedBefore).
+	ReceivedAfter  time.Time
+	ReceivedBefore time.Time
+	// StoredAfter restricts the result to reports stored at or after
+	// StoredAfter. Imported reports are stored when they are imported, so
+	// clients polling with it receive them even if they were received long
+	// before.
+	StoredAfter time.Time
+	Origins     []reportOrigin
+	Regions     []string
+}
+
+// conditions returns the filter's SQL conditions, each preceded by AND, and
+// appends their arguments to args.
+// A nil filter only restricts the result to the default tenant.
+func (f *reportFilter) conditions(args []interface{}) (string, []interface{}) {
+	if f == nil {
+		f = &reportFilter{}
+	}
+
+	args = append(args, f.TenantID)
+	conds := fmt.Sprintf(" AND sr.tenant_id = $%d", len(args))
+	if len(f.MemoTypes) > 0 {
+		memoTypes := make([]int64, len(f.MemoTypes))
+		for i, mt := range f.MemoTypes {
+			memoTypes[i] = int64(mt)
+		}
+		args = append(args, pq.Array(memoTypes))
+		conds += fmt.Sprintf(" AND m.mtype = ANY($%d)", len(args))
+	}
+	if !f.ReceivedAfter.IsZero() {
+		args = append(args, f.ReceivedAfter)
+		conds += fmt.Sprintf(" AND r.timestamp >= $%d", len(args))
+	}
+	if !f.ReceivedBefore.IsZero() {
+		args = append(args, f.ReceivedBefore)
+		conds += fmt.Sprintf(" AND r.timestamp < $%d", len(args))
+	}
+	if !f.StoredAfter.IsZero() {
+		args = append(args, f.StoredAfter)
+		conds += fmt.Sprintf(" AND sr.stored_at >= $%d", len(args))
+	}
+	if len(f.Origins) > 0 {
+		origins := make([]string, len(f.Origins))
+		for i, o := range f.Origins {
+			origins[i] = string(o)
+		}
+		args = append(args, pq.Array(origins))
+		conds += fmt.Sprintf(" AND sr.origin = ANY($%d)", len(args))
+	}
+	if len(f.Regions) > 0 {
+		args = append(args, pq.Array(f.Regions))
+		conds += fmt.Sprintf(" AND sr.region = ANY($%d)", len(args))
+	}
+	return conds, args
+}
+
+// matches returns whether sr passes the filter. It's used for reports that
+// weren't loaded with the filter's conditions.
+func (f *reportFilter) matches(sr *storedSignedReport) bool {
+	if f == nil {
+		f = &reportFilter{}
+	}
+
+	meta := &sr.Metadata
+	if meta.TenantID != f.TenantID {
+		return false
+	}
+	if len(f.MemoTypes) > 0 && !containsUint8(f.MemoTypes, sr.Report.Memo.Type) {
+		return false
+	}
+	if !f.ReceivedAfter.IsZero() && meta.ReceivedAt.Before(f.ReceivedAfter) {
+		return false
+	}
+	if !f.ReceivedBefore.IsZero() && !meta.ReceivedAt.Before(f.ReceivedBefore) {
+		return false
+	}
+	if !f.StoredAfter.IsZero() && meta.StoredAt.Before(f.StoredAfter) {
+		return false
+	}
+	if len(f.Origins) > 0 {
+		found := false
+		for _, o := range f.Origins {
+			found = found || o == meta.Origin
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Regions) > 0 {
+		found := false
+		for _, r := range f.Regions {
+			found = found || r == meta.Region
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsUint8(list []uint8, v uint8) bool {
+	for _, e := range list {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *DBConnection) getSignedReports(filter *reportFilter) ([]*storedSignedReport, error) {
+	conds, args := filter.conditions(nil)
 	rows, err := db.Queryx(
 		`
-		SELECT r.rvk, r.tck_bytes, r.j_1, r.j_2, m.mtype, m.mlen, m.mdata, sr.sig
+		SELECT sr.id, r.rvk, r.tck_bytes, r.j_1, r.j_2, m.mtype, m.mlen, m.mdata, sr.sig,
+			r.timestamp, sr.stored_at, sr.origin, sr.verification, COALESCE(sr.region, ''),
+			sr.tenant_id
 		FROM SignedReport sr
 		JOIN Report r ON sr.report_id = r.id
-		JOIN Memo m ON r.memo_id = m.id;
+		JOIN Memo m ON r.memo_id = m.id
+		WHERE TRUE`+conds+`
+		ORDER BY sr.id;
 		`,
+		args...,
 	)
 	if err != nil {
 		fmt.Printf("Failed to get signed reports from database: %s\n", err.Error())
@@ -152,27 +620,37 @@ func (db *DBConnection) getSignedReports() ([]*tcn.SignedReport, error) {
 	return signedReports, nil
 }
 
-// getNewSignedReports returns all signed reports that were made after lastReport.
-func (db *DBConnection) getNewSignedReports(lastReport *tcn.Report) ([]*tcn.SignedReport, error) {
+// getNewSignedReports returns all signed reports that were stored after
+// lastReport. They are found by their cursors rather than their receive
+// times, which imported reports keep.
+func (db *DBConnection) getNewSignedReports(lastReport *tcn.Report, filter *reportFilter) ([]*storedSignedReport, error) {
+	conds, args := filter.conditions([]interface{}{
+		lastReport.RVK,
+		lastReport.TCKBytes[:],
+		lastReport.J1,
+		lastReport.J2,
+	})
 	rows, err := db.Queryx(
 		`
-		SELECT r.rvk, r.tck_bytes, r.j_1, r.j_2, m.mtype, m.mlen, m.mdata, sr.sig
+		SELECT sr.id, r.rvk, r.tck_bytes, r.j_1, r.j_2, m.mtype, m.mlen, m.mdata, sr.sig,
+			r.timestamp, sr.stored_at, sr.origin, sr.verification, COALESCE(sr.region, ''),
+			sr.tenant_id
 		FROM SignedReport sr
 		JOIN Report r ON sr.report_id = r.id
 		JOIN Memo m ON r.memo_id = m.id
-		WHERE r.timestamp > (
-			SELECT MIN(r2.timestamp)
-			FROM Report r2
+		WHERE sr.id > (
+			SELECT MIN(sr2.id)
+			FROM SignedReport sr2
+			JOIN Report r2 ON sr2.report_id = r2.id
 			WHERE r2.rvk = $1
 			AND r2.tck_bytes = $2
 			AND r2.j_1 = $3
 			AND r2.j_2 = $4
-		);
+			AND sr2.tenant_id = sr.tenant_id
+		)`+conds+`
+		ORDER BY sr.id;
 		`,
-		lastReport.RVK,
-		lastReport.TCKBytes[:],
-		lastReport.J1,
-		lastReport.J2,
+		args...,
 	)
 	if err != nil {
 		fmt.Printf("Failed to get signed reports from database: %s\n", err.Error())
@@ -185,3 +663,72 @@ func (db *DBConnection) getNewSignedReports(lastReport *tcn.Report) ([]*tcn.Sign
 	}
 	return signedReports, nil
 }
+
+// getSignedReportsAfter returns at most limit signed reports that come after
+// cursor in the feed. Reports are committed in the order of their IDs (see
+// storeReports), so no report after the returned ones can show up later
+// before them, and the ID of the last one is a safe cursor for the next call.
+func (db *DBConnection) getSignedReportsAfter(cursor uint64, limit int, filter *reportFilter) ([]*storedSignedReport, error) {
+	conds, args := filter.conditions([]interface{}{cursor, limit})
+	rows, err := db.Queryx(
+		`
+		SELECT sr.id, r.rvk, r.tck_bytes, r.j_1, r.j_2, m.mtype, m.mlen, m.mdata, sr.sig,
+			r.timestamp, sr.stored_at, sr.origin, sr.verification, COALESCE(sr.region, ''),
+			sr.tenant_id
+		FROM SignedReport sr
+		JOIN Report r ON sr.report_id = r.id
+		JOIN Memo m ON r.memo_id = m.id
+		WHERE sr.id > $1`+conds+`
+		ORDER BY sr.id
+		LIMIT $2;
+		`,
+		args...,
+	)
+	if err != nil {
+		fmt.Printf("Failed to get signed reports from database: %s\n", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	return db.scanSignedReports(rows)
+}
+
+// getLatestSignedReportID returns the cursor of the latest signed report of
+// all tenants, or 0 if there is none.
+func (db *DBConnection) getLatestSignedReportID() (uint64, error) {
+	var id uint64
+	if err := db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM SignedReport;`).Scan(&id); err != nil {
+		fmt.Printf("Failed to get latest signed report ID from database: %s\n", err.Error())
+		return 0, err
+	}
+	return id, nil
+}
+
+// getSignedReportByID returns the signed report with the given ID,
+// independent of its tenant. It must only be used internally.
+func (db *DBConnection) getSignedReportByID(id uint64) (*storedSignedReport, error) {
+	rows, err := db.Queryx(
+		`
+		SELECT sr.id, r.rvk, r.tck_bytes, r.j_1, r.j_2, m.mtype, m.mlen, m.mdata, sr.sig,
+			r.timestamp, sr.stored_at, sr.origin, sr.verification, COALESCE(sr.region, ''),
+			sr.tenant_id
+		FROM SignedReport sr
+		JOIN Report r ON sr.report_id = r.id
+		JOIN Memo m ON r.memo_id = m.id
+		WHERE sr.id = $1;
+		`,
+		id,
+	)
+	if err != nil {
+		fmt.Printf("Failed to get signed report from database: %s\n", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	signedReports, err := db.scanSignedReports(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(signedReports) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return signedReports[0], nil
+}
@@ -1,25 +1,55 @@
 CREATE DOMAIN uint8 AS smallint
    CHECK(VALUE >= 0 AND VALUE < 256);
 
+CREATE DOMAIN uint16 AS integer
+   CHECK(VALUE >= 0 AND VALUE < 65536);
+
 CREATE TABLE IF NOT EXISTS Memo (
     id bigserial primary key,
     mtype uint8 not null,
     mlen uint8 not null,
-    mdata bytea
+    mdata bytea,
+    tenant_id text not null default ''
 );
 
 CREATE TABLE IF NOT EXISTS Report (
     id bigserial primary key,
     rvk bytea not null,
     tck_bytes bytea not null,
-    j_1 uint8 not null,
-    j_2 uint8 not null,
+    j_1 uint16 not null,
+    j_2 uint16 not null,
     memo_id bigserial not null references Memo(id),
-    timestamp timestamp default current_timestamp
+    timestamp timestamptz not null default current_timestamp,
+    tenant_id text not null default ''
 );
 
 CREATE TABLE IF NOT EXISTS SignedReport (
     id bigserial primary key,
     report_id bigserial not null references Report(id),
-    sig bytea not null
-);
\ No newline at end of file
+    sig bytea not null,
+    origin text not null default 'upload',
+    verification text not null default 'signature',
+    region text,
+    tenant_id text not null default '',
+    -- sha256(rvk || tck_bytes || sig), see signedReportHash.
+    hash bytea not null,
+    -- Later than Report.timestamp for imported reports.
+    stored_at timestamptz not null default current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS report_timestamp_idx ON Report(timestamp);
+CREATE INDEX IF NOT EXISTS signedreport_stored_at_idx ON SignedReport(stored_at);
+CREATE INDEX IF NOT EXISTS signedreport_region_idx ON SignedReport(region);
+CREATE INDEX IF NOT EXISTS report_tenant_idx ON Report(tenant_id);
+CREATE INDEX IF NOT EXISTS signedreport_tenant_idx ON SignedReport(tenant_id);
+CREATE UNIQUE INDEX IF NOT EXISTS signedreport_hash_idx ON SignedReport(tenant_id, hash);
+
+-- Differentially private statistics, stored once they were computed so that
+-- the noise can't be averaged out by repeated requests.
+CREATE TABLE IF NOT EXISTS DailyStats (
+    tenant_id text not null default '',
+    day date not null,
+    region text not null default '',
+    stats text not null,
+    primary key (tenant_id, day, region)
+);
@@ -0,0 +1,8 @@
+-- Key indices are uint16 values in the TCN protocol, but databases created
+-- from earlier versions of db.sql store them as uint8.
+CREATE DOMAIN uint16 AS integer
+   CHECK(VALUE >= 0 AND VALUE < 65536);
+
+ALTER TABLE Report
+    ALTER COLUMN j_1 TYPE uint16,
+    ALTER COLUMN j_2 TYPE uint16;
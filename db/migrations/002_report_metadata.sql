@@ -0,0 +1,10 @@
+-- The receive time of a report is returned to clients and compared with
+-- timestamps from requests, so it must not depend on the server's time zone.
+ALTER TABLE Report
+    ALTER COLUMN timestamp TYPE timestamptz,
+    ALTER COLUMN timestamp SET NOT NULL;
+
+-- Where a signed report came from and how it was verified.
+ALTER TABLE SignedReport
+    ADD COLUMN origin text not null default 'upload',
+    ADD COLUMN verification text not null default 'signature';
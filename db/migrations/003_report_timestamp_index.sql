@@ -0,0 +1,2 @@
+-- Downloads filter reports by their receive time.
+CREATE INDEX IF NOT EXISTS report_timestamp_idx ON Report(timestamp);
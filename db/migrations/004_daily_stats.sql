@@ -0,0 +1,6 @@
+-- Differentially private statistics, stored once they were computed so that
+-- the noise can't be averaged out by repeated requests.
+CREATE TABLE IF NOT EXISTS DailyStats (
+    day date primary key,
+    stats text not null
+);
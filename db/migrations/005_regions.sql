@@ -0,0 +1,11 @@
+-- The region a report was uploaded for. Reports uploaded without region have
+-- none.
+ALTER TABLE SignedReport
+    ADD COLUMN region text;
+CREATE INDEX IF NOT EXISTS signedreport_region_idx ON SignedReport(region);
+
+-- Statistics are stored per region; '' are the statistics of all regions.
+ALTER TABLE DailyStats
+    ADD COLUMN region text not null default '',
+    DROP CONSTRAINT dailystats_pkey,
+    ADD PRIMARY KEY (day, region);
@@ -0,0 +1,15 @@
+-- The tenant a row belongs to. Existing rows belong to the default tenant ''.
+ALTER TABLE Memo
+    ADD COLUMN tenant_id text not null default '';
+ALTER TABLE Report
+    ADD COLUMN tenant_id text not null default '';
+ALTER TABLE SignedReport
+    ADD COLUMN tenant_id text not null default '';
+CREATE INDEX IF NOT EXISTS report_tenant_idx ON Report(tenant_id);
+CREATE INDEX IF NOT EXISTS signedreport_tenant_idx ON SignedReport(tenant_id);
+
+-- Statistics are stored per tenant.
+ALTER TABLE DailyStats
+    ADD COLUMN tenant_id text not null default '',
+    DROP CONSTRAINT dailystats_pkey,
+    ADD PRIMARY KEY (tenant_id, day, region);
@@ -0,0 +1,30 @@
+-- Identifies a signed report within its tenant, so that duplicates are
+-- rejected by the unique index instead of being looked up one by one.
+ALTER TABLE SignedReport
+    ADD COLUMN hash bytea;
+UPDATE SignedReport sr
+    SET hash = sha256(r.rvk || r.tck_bytes || sr.sig)
+    FROM Report r
+    WHERE sr.report_id = r.id;
+
+-- Remove duplicates stored before the index existed, keeping the first copy.
+WITH duplicates AS (
+    DELETE FROM SignedReport a
+    USING SignedReport b
+    WHERE a.tenant_id = b.tenant_id
+    AND a.hash = b.hash
+    AND a.id > b.id
+    RETURNING a.report_id
+), reports AS (
+    DELETE FROM Report r
+    USING duplicates d
+    WHERE r.id = d.report_id
+    RETURNING r.memo_id
+)
+DELETE FROM Memo m
+USING reports r
+WHERE m.id = r.memo_id;
+
+ALTER TABLE SignedReport
+    ALTER COLUMN hash SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS signedreport_hash_idx ON SignedReport(tenant_id, hash);
@@ -0,0 +1,10 @@
+-- The time a signed report was stored by this server. 'since' downloads use
+-- it instead of the receive time, which imported reports keep. Existing
+-- reports were stored when they were received.
+ALTER TABLE SignedReport
+    ADD COLUMN stored_at timestamptz not null default current_timestamp;
+UPDATE SignedReport sr
+    SET stored_at = r.timestamp
+    FROM Report r
+    WHERE sr.report_id = r.id;
+CREATE INDEX IF NOT EXISTS signedreport_stored_at_idx ON SignedReport(stored_at);
@@ -0,0 +1,31 @@
+//go:build go1.18
+// +build go1.18
+
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func FuzzPostTCNReport(f *testing.F) {
+	b := signedReportBytes(f, generateSignedReport(f))
+	f.Add(b)
+	f.Add(b[:len(b)-1])
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		rec, req := getPostRequest(data)
+		ctx, _ := gin.CreateTestContext(rec)
+		ctx.Request = req
+
+		handler.postTCNReport(ctx)
+
+		// Arbitrary input must never cause a server error.
+		if rec.Code != http.StatusOK && rec.Code != http.StatusBadRequest {
+			t.Fatalf("Unexpected status %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
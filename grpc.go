@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/ito-org/go-backend/tcn/tcnpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultListLimit is the number of reports returned by List if the
+	// client doesn't set a limit.
+	defaultListLimit = 100
+	// maxListLimit is the maximum number of reports returned by List.
+	maxListLimit = 1000
+)
+
+// NewGRPCServer returns a gRPC server serving the TCN report service. It uses
+// the same storage and validation as the HTTP handlers. tenants and tlsConfig
+// may be nil.
+func NewGRPCServer(dbConnection *DBConnection, config *Config, tenants *tenants, tlsConfig *tls.Config) *grpc.Server {
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	s := grpc.NewServer(opts...)
+	tcnpb.RegisterTCNReportServiceServer(s, &tcnReportServer{
+		dbConn:  dbConnection,
+		config:  config,
+		tenants: tenants,
+	})
+	return s
+}
+
+// tcnReportServer implements tcnpb.TCNReportServiceServer.
+type tcnReportServer struct {
+	dbConn  *DBConnection
+	config  *Config
+	tenants *tenants
+}
+
+// configFor returns the configuration of the tenant of the call, like
+// resolveTenant does for HTTP requests. The tenant is given by the tenant
+// header in the request metadata or by the call's authority.
+func (s *tcnReportServer) configFor(ctx context.Context) (*Config, error) {
+	if s.tenants == nil {
+		return s.config, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var id, host string
+	if values := md.Get(tenantHeader); len(values) > 0 {
+		id = values[0]
+	}
+	if values := md.Get(":authority"); len(values) > 0 {
+		host = values[0]
+	}
+	config, ok := s.tenants.lookup(id, host)
+	if !ok {
+		return nil, status.Error(codes.NotFound, unknownTenantError)
+	}
+	return config, nil
+}
+
+func (s *tcnReportServer) Upload(ctx context.Context, req *tcnpb.UploadRequest) (*tcnpb.UploadResponse, error) {
+	config, err := s.configFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	signedReport, err := tcn.SignedReportFromProto(req.SignedReport)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := validateSignedReport(config, signedReport); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if req.Region != "" && !config.acceptsRegion(req.Region) {
+		return nil, status.Error(codes.InvalidArgument, unknownRegionError)
+	}
+
+	meta := reportMetadata{
+		Origin:   originUpload,
+		Region:   req.Region,
+		TenantID: config.TenantID,
+	}
+	if isDecoyUpload(ctx) {
+		err = s.dbConn.insertDecoySignedReports([]*tcn.SignedReport{signedReport}, meta)
+	} else {
+		err = s.dbConn.insertSignedReport(signedReport, meta)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &tcnpb.UploadResponse{}, nil
+}
+
+// isDecoyUpload returns whether the upload is marked as a decoy with the
+// decoy header in the request metadata.
+func isDecoyUpload(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(decoyHeader)
+	return len(values) > 0 && values[0] == "1"
+}
+
+// List returns the signed reports after the cursor of the request. The next
+// cursor is the ID of the last returned report, which is safe to continue
+// from because reports are committed in the order of their IDs.
+func (s *tcnReportServer) List(ctx context.Context, req *tcnpb.ListRequest) (*tcnpb.ListResponse, error) {
+	config, err := s.configFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	for _, r := range req.Regions {
+		if !config.acceptsRegion(r) {
+			return nil, status.Error(codes.InvalidArgument, unknownRegionError)
+		}
+	}
+
+	filter := &reportFilter{
+		TenantID: config.TenantID,
+		Regions:  req.Regions,
+	}
+	signedReports, err := s.dbConn.getSignedReportsAfter(req.Cursor, limit, filter)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &tcnpb.ListResponse{
+		SignedReports: make([]*tcnpb.SignedReport, 0, len(signedReports)),
+		NextCursor:    req.Cursor,
+	}
+	for _, sr := range signedReports {
+		resp.SignedReports = append(resp.SignedReports, sr.ToProto())
+		resp.NextCursor = sr.ID
+	}
+	return resp, nil
+}
+
+func (s *tcnReportServer) Stream(req *tcnpb.StreamRequest, stream tcnpb.TCNReportService_StreamServer) error {
+	config, err := s.configFor(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	filter := &reportFilter{TenantID: config.TenantID}
+	err = s.dbConn.followSignedReports(stream.Context(), req.Cursor, filter, func(sr *storedSignedReport) error {
+		if sr == nil {
+			return nil
+		}
+		return stream.Send(&tcnpb.StreamResponse{
+			SignedReport: sr.ToProto(),
+			Cursor:       sr.ID,
+		})
+	})
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/ito-org/go-backend/tcn/tcnpb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCUploadAndList(t *testing.T) {
+	s := &tcnReportServer{dbConn: handler.dbConn, config: handler.config}
+
+	// Remember where the feed ends before uploading
+	resp, err := s.List(context.Background(), &tcnpb.ListRequest{Cursor: 0, Limit: maxListLimit})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	cursor := resp.NextCursor
+	for len(resp.SignedReports) == maxListLimit {
+		resp, err = s.List(context.Background(), &tcnpb.ListRequest{Cursor: cursor, Limit: maxListLimit})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		cursor = resp.NextCursor
+	}
+
+	signedReports := [3]*tcn.SignedReport{}
+	for i := range signedReports {
+		signedReport := generateSignedReport(t)
+		_, err = s.Upload(context.Background(), &tcnpb.UploadRequest{SignedReport: signedReport.ToProto()})
+		assert.NoError(t, err)
+		signedReports[i] = signedReport
+	}
+
+	resp, err = s.List(context.Background(), &tcnpb.ListRequest{Cursor: cursor, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, resp.SignedReports, 2)
+
+	resp2, err := s.List(context.Background(), &tcnpb.ListRequest{Cursor: resp.NextCursor})
+	assert.NoError(t, err)
+
+	retSignedReports := []*tcn.SignedReport{}
+	for _, psr := range append(resp.SignedReports, resp2.SignedReports...) {
+		sr, err := tcn.SignedReportFromProto(psr)
+		assert.NoError(t, err)
+		retSignedReports = append(retSignedReports, sr)
+	}
+
+	found := 0
+	for _, r := range signedReports {
+		for _, rr := range retSignedReports {
+			if reflect.DeepEqual(r, rr) {
+				found++
+			}
+		}
+	}
+	assert.Equal(t, len(signedReports), found)
+}
+
+func TestGRPCUploadInvalidSig(t *testing.T) {
+	s := &tcnReportServer{dbConn: handler.dbConn, config: handler.config}
+
+	_, _, report, _ := tcn.GenerateReport(1, 2, testMemoData)
+	_, rak2, _, _ := tcn.GenerateReport(1, 2, testMemoData)
+	fakeSignedReport, err := tcn.GenerateSignedReport(rak2, report)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = s.Upload(context.Background(), &tcnpb.UploadRequest{SignedReport: fakeSignedReport.ToProto()})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCUploadRegion(t *testing.T) {
+	config := DefaultConfig()
+	config.Regions = []string{"by"}
+	s := &tcnReportServer{dbConn: handler.dbConn, config: config}
+
+	signedReport := generateSignedReport(t)
+
+	_, err := s.Upload(context.Background(), &tcnpb.UploadRequest{SignedReport: signedReport.ToProto(), Region: "be"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.Upload(context.Background(), &tcnpb.UploadRequest{SignedReport: signedReport.ToProto(), Region: "by"})
+	assert.NoError(t, err)
+
+	// The report is the last one of the region.
+	cursor := uint64(0)
+	var last *tcnpb.SignedReport
+	for {
+		resp, err := s.List(context.Background(), &tcnpb.ListRequest{Cursor: cursor, Limit: maxListLimit, Regions: []string{"by"}})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(resp.SignedReports) == 0 {
+			break
+		}
+		last = resp.SignedReports[len(resp.SignedReports)-1]
+		cursor = resp.NextCursor
+	}
+	sr, err := tcn.SignedReportFromProto(last)
+	assert.NoError(t, err)
+	assert.Equal(t, signedReport, sr)
+
+	_, err = s.List(context.Background(), &tcnpb.ListRequest{Regions: []string{"be"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCTenants(t *testing.T) {
+	tenants, err := newTenants([]*tenantSettings{
+		{ID: "tenant-a", Hostnames: []string{"a.example.org"}},
+		{ID: "tenant-b"},
+	}, DefaultConfig())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	s := &tcnReportServer{dbConn: handler.dbConn, config: DefaultConfig(), tenants: tenants}
+
+	for _, tc := range []struct {
+		md       metadata.MD
+		tenantID string
+		code     codes.Code
+	}{
+		{metadata.Pairs(tenantHeader, "tenant-b"), "tenant-b", codes.OK},
+		{metadata.Pairs(":authority", "a.example.org:443"), "tenant-a", codes.OK},
+		{metadata.Pairs(":authority", "localhost"), "", codes.NotFound},
+		{metadata.Pairs(tenantHeader, "tenant-c"), "", codes.NotFound},
+	} {
+		config, err := s.configFor(metadata.NewIncomingContext(context.Background(), tc.md))
+		assert.Equal(t, tc.code, status.Code(err))
+		if err == nil {
+			assert.Equal(t, tc.tenantID, config.TenantID)
+		}
+	}
+
+	signedReport := generateSignedReport(t)
+	ctxA := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenantHeader, "tenant-a"))
+	_, err = s.Upload(ctxA, &tcnpb.UploadRequest{SignedReport: signedReport.ToProto()})
+	assert.NoError(t, err)
+
+	// Tenant B doesn't see the report of tenant A.
+	ctxB := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenantHeader, "tenant-b"))
+	cursor := uint64(0)
+	for {
+		resp, err := s.List(ctxB, &tcnpb.ListRequest{Cursor: cursor, Limit: maxListLimit})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(resp.SignedReports) == 0 {
+			break
+		}
+		for _, pb := range resp.SignedReports {
+			sr, err := tcn.SignedReportFromProto(pb)
+			assert.NoError(t, err)
+			assert.NotEqual(t, signedReport, sr)
+		}
+		cursor = resp.NextCursor
+	}
+}
+
+func TestGRPCListConcurrentCommits(t *testing.T) {
+	tenants, err := newTenants([]*tenantSettings{{ID: "grpc-commit-order-test"}}, DefaultConfig())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	s := &tcnReportServer{dbConn: handler.dbConn, config: DefaultConfig(), tenants: tenants}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenantHeader, "grpc-commit-order-test"))
+
+	cursor, err := handler.dbConn.getLatestSignedReportID()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	signedReports := generateSignedReports(t, 2)
+	meta := reportMetadata{Origin: originUpload, TenantID: "grpc-commit-order-test"}
+
+	// The cursor doesn't move past the report of the first transaction
+	// while it isn't committed.
+	storeInterleaved(t, signedReports, meta, func() {
+		resp, err := s.List(ctx, &tcnpb.ListRequest{Cursor: cursor})
+		assert.NoError(t, err)
+		assert.Empty(t, resp.SignedReports)
+		assert.Equal(t, cursor, resp.NextCursor)
+	})
+
+	resp, err := s.List(ctx, &tcnpb.ListRequest{Cursor: cursor})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	retSignedReports := []*tcn.SignedReport{}
+	for _, pb := range resp.SignedReports {
+		sr, err := tcn.SignedReportFromProto(pb)
+		assert.NoError(t, err)
+		retSignedReports = append(retSignedReports, sr)
+	}
+	assert.Equal(t, signedReports, retSignedReports)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ito-org/go-backend/tcn"
+)
+
+// reportSeed seeds the keys of the reports generated by tests. Every test
+// derives its own random source from the seed and its name, so the reports
+// of a failing test can be reproduced with
+// go test -run <test> -args -report-seed <seed>.
+var reportSeed = flag.Int64("report-seed", time.Now().UnixNano(), "Seed of the keys of generated test reports")
+
+var (
+	reportRandsMu sync.Mutex
+	reportRands   = map[testing.TB]*rand.Rand{}
+	// reportRuns counts the tests with the same name, so that repeated runs
+	// (-count) don't generate the same reports.
+	reportRuns = map[string]int64{}
+)
+
+// reportRand returns the random source of the reports generated by t. The
+// caller must hold reportRandsMu.
+func reportRand(t testing.TB) *rand.Rand {
+	r, ok := reportRands[t]
+	if !ok {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(t.Name()))
+		seed := (*reportSeed ^ int64(h.Sum64())) + reportRuns[t.Name()]
+		reportRuns[t.Name()]++
+		r = rand.New(rand.NewSource(seed))
+		reportRands[t] = r
+		t.Logf("Generating reports with -report-seed %d", *reportSeed)
+	}
+	return r
+}
+
+// generateSignedReportRange returns a signed report with testMemoData that
+// covers the keys [j1, j2). The key range isn't checked, so tests can create
+// invalid reports.
+func generateSignedReportRange(t testing.TB, j1, j2 uint16) *tcn.SignedReport {
+	t.Helper()
+	reportRandsMu.Lock()
+	defer reportRandsMu.Unlock()
+
+	_, rak, report, err := tcn.GenerateReportFrom(reportRand(t), j1, j2, testMemoData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedReport, err := tcn.GenerateSignedReport(rak, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signedReport
+}
+
+// generateSignedReport returns a valid signed report with testMemoData.
+func generateSignedReport(t testing.TB) *tcn.SignedReport {
+	t.Helper()
+	return generateSignedReportRange(t, 1, 2)
+}
+
+// generateSignedReports returns n valid signed reports with testMemoData.
+func generateSignedReports(t testing.TB, n int) []*tcn.SignedReport {
+	t.Helper()
+	signedReports := make([]*tcn.SignedReport, n)
+	for i := range signedReports {
+		signedReports[i] = generateSignedReport(t)
+	}
+	return signedReports
+}
+
+// signedReportBytes returns signedReport in the TCN wire format.
+func signedReportBytes(t testing.TB, signedReport *tcn.SignedReport) []byte {
+	t.Helper()
+	b, err := signedReport.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
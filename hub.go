@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	// subscriberBufferSize is the number of reports buffered per subscriber.
+	// Subscribers that fall further behind are dropped and catch up from the
+	// database.
+	subscriberBufferSize = 256
+	// heartbeatInterval is the interval in which followSignedReports lets
+	// callers send keep-alives.
+	heartbeatInterval = 15 * time.Second
+	// reportNotifyChannel is the Postgres channel on which new report IDs are
+	// announced when LISTEN/NOTIFY is enabled.
+	reportNotifyChannel = "tcnreport"
+	// latestCursor makes followSignedReports start after the latest stored
+	// report, i.e. only send reports stored from then on.
+	latestCursor = math.MaxUint64
+)
+
+// reportHub distributes newly stored signed reports to subscribers within
+// the process.
+type reportHub struct {
+	mu   sync.Mutex
+	subs map[chan *storedSignedReport]struct{}
+}
+
+func newReportHub() *reportHub {
+	return &reportHub{
+		subs: map[chan *storedSignedReport]struct{}{},
+	}
+}
+
+// subscribe returns a channel that receives all reports published from now
+// on. The channel is closed if the subscriber can't keep up.
+func (h *reportHub) subscribe() chan *storedSignedReport {
+	ch := make(chan *storedSignedReport, subscriberBufferSize)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *reportHub) unsubscribe(ch chan *storedSignedReport) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// publish sends sr to all subscribers without blocking.
+func (h *reportHub) publish(sr *storedSignedReport) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- sr:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// listenForReports announces stored reports through Postgres NOTIFY instead
+// of publishing them directly, and publishes the reports announced by all
+// replicas to the local hub.
+func (db *DBConnection) listenForReports() error {
+	listener := pq.NewListener(db.connStr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			fmt.Printf("Report listener: %s\n", err.Error())
+		}
+	})
+	if err := listener.Listen(reportNotifyChannel); err != nil {
+		return err
+	}
+
+	db.notify = true
+	go func() {
+		for n := range listener.Notify {
+			// n is nil after the listener had to reconnect
+			if n == nil {
+				continue
+			}
+			id, err := strconv.ParseUint(n.Extra, 10, 64)
+			if err != nil {
+				fmt.Printf("Invalid report notification: %s\n", n.Extra)
+				continue
+			}
+			sr, err := db.getSignedReportByID(id)
+			if err != nil {
+				continue
+			}
+			db.hub.publish(sr)
+		}
+	}()
+	return nil
+}
+
+// notifySignedReports announces reports stored in tx through Postgres NOTIFY
+// if it's enabled. The notifications are delivered when tx is committed, in
+// commit order.
+func (db *DBConnection) notifySignedReports(tx *sqlx.Tx, stored []*storedSignedReport) error {
+	if !db.notify {
+		return nil
+	}
+	for _, sr := range stored {
+		if _, err := tx.Exec(`SELECT pg_notify($1, $2);`, reportNotifyChannel, strconv.FormatUint(sr.ID, 10)); err != nil {
+			fmt.Printf("Failed to notify about new report: %s\n", err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// publishSignedReports makes newly stored reports available to followers
+// unless they are announced through NOTIFY.
+func (db *DBConnection) publishSignedReports(stored []*storedSignedReport) {
+	if db.notify {
+		return
+	}
+	for _, sr := range stored {
+		db.hub.publish(sr)
+	}
+}
+
+// followSignedReports calls send for every signed report after cursor that
+// passes filter, first from the database and then as new reports are stored,
+// until ctx is done or send fails. With latestCursor, only reports stored
+// from now on are sent. send is also called with nil every
+// heartbeatInterval so callers can keep connections alive.
+func (db *DBConnection) followSignedReports(ctx context.Context, cursor uint64, filter *reportFilter, send func(*storedSignedReport) error) error {
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		// Subscribe before catching up so no report gets lost in between.
+		sub := db.hub.subscribe()
+
+		if cursor == latestCursor {
+			var err error
+			if cursor, err = db.getLatestSignedReportID(); err != nil {
+				db.hub.unsubscribe(sub)
+				return err
+			}
+		}
+
+		for {
+			signedReports, err := db.getSignedReportsAfter(cursor, maxListLimit, filter)
+			if err != nil {
+				db.hub.unsubscribe(sub)
+				return err
+			}
+			for _, sr := range signedReports {
+				if err := send(sr); err != nil {
+					db.hub.unsubscribe(sub)
+					return err
+				}
+				cursor = sr.ID
+			}
+			if len(signedReports) < maxListLimit {
+				break
+			}
+		}
+
+	follow:
+		for {
+			select {
+			case <-ctx.Done():
+				db.hub.unsubscribe(sub)
+				return nil
+			case <-heartbeat.C:
+				if err := send(nil); err != nil {
+					db.hub.unsubscribe(sub)
+					return err
+				}
+			case sr, ok := <-sub:
+				if !ok {
+					// Dropped for being too slow, catch up from the database.
+					break follow
+				}
+				// Reports are committed and announced in the order of their
+				// IDs, so the ones up to cursor were sent during catch-up.
+				if sr.ID <= cursor {
+					continue
+				}
+				cursor = sr.ID
+				if !filter.matches(sr) {
+					continue
+				}
+				if err := send(sr); err != nil {
+					db.hub.unsubscribe(sub)
+					return err
+				}
+			}
+		}
+	}
+}
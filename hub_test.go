@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportHub(t *testing.T) {
+	hub := newReportHub()
+	sub := hub.subscribe()
+	slowSub := hub.subscribe()
+
+	// Fill the slow subscriber's buffer
+	for i := 0; i < subscriberBufferSize; i++ {
+		hub.publish(&storedSignedReport{ID: uint64(i)})
+		<-sub
+	}
+	hub.publish(&storedSignedReport{ID: subscriberBufferSize})
+
+	sr, ok := <-sub
+	assert.True(t, ok)
+	assert.Equal(t, uint64(subscriberBufferSize), sr.ID)
+
+	// The slow subscriber got dropped after its buffer was drained
+	for i := 0; i < subscriberBufferSize; i++ {
+		<-slowSub
+	}
+	_, ok = <-slowSub
+	assert.False(t, ok)
+
+	hub.unsubscribe(sub)
+	hub.unsubscribe(slowSub)
+	_, ok = <-sub
+	assert.False(t, ok)
+}
+
+func TestStreamTCNReports(t *testing.T) {
+	var cursor uint64
+	if err := handler.dbConn.QueryRow("SELECT COALESCE(MAX(id), 0) FROM SignedReport").Scan(&cursor); err != nil {
+		t.Error(err)
+		return
+	}
+
+	r := gin.New()
+	r.GET("/tcnreport/stream", handler.streamTCNReports)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/tcnreport/stream", nil)
+	req.Header.Set("Last-Event-ID", strconv.FormatUint(cursor, 10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	signedReport := generateSignedReport(t)
+	b := signedReportBytes(t, signedReport)
+	postSignedReports(b)
+
+	// Read events until the new report shows up
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data: ") && strings.TrimPrefix(line, "data: ") == hex.EncodeToString(b) {
+			return
+		}
+	}
+	t.Error("Stream ended without the new report")
+}
+
+func TestFollowSignedReportsConcurrentCommits(t *testing.T) {
+	cursor, err := handler.dbConn.getLatestSignedReportID()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	signedReports := generateSignedReports(t, 3)
+	meta := reportMetadata{Origin: originUpload, TenantID: "follow-test"}
+	if err := handler.dbConn.insertSignedReport(signedReports[0], meta); err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sent := make(chan *storedSignedReport, 10)
+	filter := &reportFilter{TenantID: meta.TenantID}
+	go handler.dbConn.followSignedReports(ctx, cursor, filter, func(sr *storedSignedReport) error {
+		if sr != nil {
+			sent <- sr
+		}
+		return nil
+	})
+
+	caughtUp := <-sent
+	assert.Equal(t, signedReports[0], caughtUp.SignedReport)
+
+	// Nothing is sent while the first of two concurrent transactions isn't
+	// committed, and then both reports are sent in order.
+	storeInterleaved(t, signedReports[1:], meta, func() {
+		assert.Empty(t, sent)
+	})
+	first, second := <-sent, <-sent
+	assert.Equal(t, signedReports[1], first.SignedReport)
+	assert.Equal(t, signedReports[2], second.SignedReport)
+
+	// Reports up to the cursor aren't sent again when they are announced.
+	handler.dbConn.hub.publish(caughtUp)
+	handler.dbConn.hub.publish(first)
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, sent)
+}
+
+func TestStreamTCNReportsLatest(t *testing.T) {
+	// Make sure there is a report that must not be replayed.
+	old := signedReportBytes(t, generateSignedReport(t))
+	postSignedReports(old)
+
+	r := gin.New()
+	r.GET("/tcnreport/stream", handler.streamTCNReports)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// Without Last-Event-ID, only reports stored from now on are sent.
+	resp, err := http.Get(server.URL + "/tcnreport/stream")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The stream might not follow the reports yet when the response
+	// arrives, so keep uploading until one is sent.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			_, rak, report, err := tcn.GenerateReport(1, 2, testMemoData)
+			if err != nil {
+				return
+			}
+			signedReport, err := tcn.GenerateSignedReport(rak, report)
+			if err != nil {
+				return
+			}
+			b, err := signedReport.Bytes()
+			if err != nil {
+				return
+			}
+			postSignedReports(b)
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data: ") {
+			assert.NotEqual(t, hex.EncodeToString(old), strings.TrimPrefix(line, "data: "))
+			return
+		}
+	}
+	t.Error("Stream ended without a new report")
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/ito-org/go-backend/tcn"
+)
+
+// readReportInput reads signed reports from the file at path, or from stdin
+// if path is empty or "-". The reports may be hex encoded; whitespace in hex
+// input is ignored.
+func readReportInput(path string) ([]byte, error) {
+	var data []byte
+	var err error
+	if path == "" || path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeReportInput(data), nil
+}
+
+// decodeReportInput returns the binary signed reports of data, which are
+// either binary already or hex encoded.
+func decodeReportInput(data []byte) []byte {
+	stripped := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, string(data))
+	if decoded, err := hex.DecodeString(stripped); err == nil && len(decoded) > 0 {
+		return decoded
+	}
+	return data
+}
+
+// decodedReport is a signed report read from a feed together with its
+// offset in the feed.
+type decodedReport struct {
+	Offset int
+	*tcn.SignedReport
+}
+
+// decodeReportFeed returns the signed reports of data. If the feed is
+// malformed, it returns the reports before the error and the error, which
+// contains the offset of the malformed report.
+func decodeReportFeed(data []byte) ([]*decodedReport, error) {
+	reports := []*decodedReport{}
+	dec := tcn.NewDecoder(bytes.NewReader(data))
+	offset := 0
+	for {
+		sr := &tcn.SignedReport{}
+		err := dec.Decode(sr)
+		if err == io.EOF {
+			return reports, nil
+		} else if err != nil {
+			return reports, fmt.Errorf("Offset %d: %s", offset, err.Error())
+		}
+		reports = append(reports, &decodedReport{Offset: offset, SignedReport: sr})
+		offset += tcn.SignedReportMinLength + len(sr.Report.Memo.Data)
+	}
+}
+
+// reportInspection contains the fields of a signed report in a readable
+// form.
+type reportInspection struct {
+	Offset       int    `json:"offset"`
+	RVK          string `json:"rvk"`
+	TCK          string `json:"tck"`
+	J1           uint16 `json:"j1"`
+	J2           uint16 `json:"j2"`
+	MemoType     string `json:"memo_type"`
+	MemoTypeName string `json:"memo_type_name,omitempty"`
+	MemoData     string `json:"memo_data"`
+	// Memo is the decoded memo data if the memo type has a decoder.
+	Memo           interface{} `json:"memo,omitempty"`
+	MemoError      string      `json:"memo_error,omitempty"`
+	Sig            string      `json:"sig"`
+	SignatureValid bool        `json:"signature_valid"`
+	// TCNs are the temporary contact numbers of [J1, J2).
+	TCNs     []string `json:"tcns"`
+	TCNError string   `json:"tcn_error,omitempty"`
+}
+
+// inspectSignedReport decodes every field of the signed report r.
+func inspectSignedReport(r *decodedReport) *reportInspection {
+	report := r.Report
+	inspection := &reportInspection{
+		Offset:   r.Offset,
+		RVK:      hex.EncodeToString(report.RVK),
+		TCK:      hex.EncodeToString(report.TCKBytes[:]),
+		J1:       report.J1,
+		J2:       report.J2,
+		MemoType: fmt.Sprintf("0x%x", report.Memo.Type),
+		MemoData: hex.EncodeToString(report.Memo.Data),
+		Sig:      hex.EncodeToString(r.Sig),
+		TCNs:     []string{},
+	}
+
+	if memoType, ok := tcn.LookupMemoType(report.Memo.Type); ok {
+		inspection.MemoTypeName = memoType.Name
+	}
+	if err := tcn.ValidateMemo(report.Memo); err != nil {
+		inspection.MemoError = err.Error()
+	} else if memo, err := tcn.DecodeMemo(report.Memo); err != nil {
+		inspection.MemoError = err.Error()
+	} else {
+		inspection.Memo = memo
+	}
+
+	ok, err := r.Verify()
+	inspection.SignatureValid = err == nil && ok
+
+	tcns, err := report.TemporaryContactNumbers()
+	if err != nil {
+		inspection.TCNError = err.Error()
+	}
+	for _, n := range tcns {
+		inspection.TCNs = append(inspection.TCNs, hex.EncodeToString(n[:]))
+	}
+	return inspection
+}
+
+// inspectionResult is the output of the inspect subcommand.
+type inspectionResult struct {
+	Reports []*reportInspection `json:"reports"`
+	// Error describes why the input couldn't be decoded completely.
+	Error string `json:"error,omitempty"`
+}
+
+// inspectReports decodes the signed reports of data.
+func inspectReports(data []byte) *inspectionResult {
+	reports, err := decodeReportFeed(data)
+	result := &inspectionResult{Reports: make([]*reportInspection, 0, len(reports))}
+	for _, r := range reports {
+		result.Reports = append(result.Reports, inspectSignedReport(r))
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// writeInspection writes result to w as JSON or as text.
+func writeInspection(w io.Writer, result *inspectionResult, asJSON bool) error {
+	if asJSON {
+		return writeJSON(w, result)
+	}
+
+	for i, r := range result.Reports {
+		memoType := r.MemoType
+		if r.MemoTypeName != "" {
+			memoType += " (" + r.MemoTypeName + ")"
+		}
+		signature := "valid"
+		if !r.SignatureValid {
+			signature = "INVALID"
+		}
+		fmt.Fprintf(w, "Report %d (offset %d)\n", i, r.Offset)
+		fmt.Fprintf(w, "  rvk:        %s\n", r.RVK)
+		fmt.Fprintf(w, "  tck:        %s\n", r.TCK)
+		fmt.Fprintf(w, "  j1, j2:     %d, %d\n", r.J1, r.J2)
+		fmt.Fprintf(w, "  memo type:  %s\n", memoType)
+		fmt.Fprintf(w, "  memo data:  %s\n", r.MemoData)
+		if r.Memo != nil {
+			memo, err := json.Marshal(r.Memo)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "  memo:       %s\n", memo)
+		}
+		if r.MemoError != "" {
+			fmt.Fprintf(w, "  memo error: %s\n", r.MemoError)
+		}
+		fmt.Fprintf(w, "  sig:        %s\n", r.Sig)
+		fmt.Fprintf(w, "  signature:  %s\n", signature)
+		if r.TCNError != "" {
+			fmt.Fprintf(w, "  tcns:       %s\n", r.TCNError)
+		} else {
+			fmt.Fprintf(w, "  tcns:       %d (j = %d to %d)\n", len(r.TCNs), r.J1, int(r.J2)-1)
+			for j, n := range r.TCNs {
+				fmt.Fprintf(w, "    %5d: %s\n", int(r.J1)+j, n)
+			}
+		}
+	}
+	if result.Error != "" {
+		fmt.Fprintf(w, "Error: %s\n", result.Error)
+	}
+	return nil
+}
+
+// reportVerification is the result of verifying one signed report.
+type reportVerification struct {
+	Offset int  `json:"offset"`
+	Valid  bool `json:"valid"`
+	// Error is the error the server would respond with to an upload of the
+	// report.
+	Error string `json:"error,omitempty"`
+}
+
+// verificationResult is the output of the verify subcommand.
+type verificationResult struct {
+	Reports []*reportVerification `json:"reports"`
+	Valid   int                   `json:"valid"`
+	Invalid int                   `json:"invalid"`
+	// Error describes why the input couldn't be decoded completely.
+	Error string `json:"error,omitempty"`
+}
+
+// verifyReports checks the signed reports of data like the server checks
+// uploads with config.
+func verifyReports(data []byte, config *Config) *verificationResult {
+	reports, err := decodeReportFeed(data)
+	result := &verificationResult{Reports: make([]*reportVerification, 0, len(reports))}
+	for _, r := range reports {
+		v := &reportVerification{Offset: r.Offset, Valid: true}
+		if err := validateSignedReport(config, r.SignedReport); err != nil {
+			v.Valid = false
+			v.Error = err.Error()
+			result.Invalid++
+		} else {
+			result.Valid++
+		}
+		result.Reports = append(result.Reports, v)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// writeVerification writes result to w as JSON or as text.
+func writeVerification(w io.Writer, result *verificationResult, asJSON bool) error {
+	if asJSON {
+		return writeJSON(w, result)
+	}
+
+	for i, r := range result.Reports {
+		if r.Valid {
+			fmt.Fprintf(w, "Report %d (offset %d): valid\n", i, r.Offset)
+		} else {
+			fmt.Fprintf(w, "Report %d (offset %d): %s\n", i, r.Offset, r.Error)
+		}
+	}
+	if result.Error != "" {
+		fmt.Fprintf(w, "Error: %s\n", result.Error)
+	}
+	fmt.Fprintf(w, "%d valid, %d invalid\n", result.Valid, result.Invalid)
+	return nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
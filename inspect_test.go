@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeReportInput(t *testing.T) {
+	signedReports := generateSignedReports(t, 1)
+	b, err := signedReports[0].Bytes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	assert.Equal(t, b, decodeReportInput(b))
+	assert.Equal(t, b, decodeReportInput([]byte(hex.EncodeToString(b)+"\n")))
+
+	// Hex dumps may be split into lines.
+	h := hex.EncodeToString(b)
+	assert.Equal(t, b, decodeReportInput([]byte(h[:64]+"\n"+h[64:])))
+}
+
+func TestInspectReports(t *testing.T) {
+	signedReports := generateSignedReports(t, 2)
+	data := []byte{}
+	for _, sr := range signedReports {
+		data, _ = sr.AppendBytes(data)
+	}
+	reportLen := len(data) / 2
+
+	// The second report is truncated.
+	result := inspectReports(data[:len(data)-1])
+	assert.Equal(t, 1, len(result.Reports))
+	assert.Equal(t, fmt.Sprintf("Offset %d: unexpected EOF", reportLen), result.Error)
+
+	result = inspectReports(data)
+	assert.Equal(t, "", result.Error)
+	assert.Equal(t, 2, len(result.Reports))
+
+	r := result.Reports[1]
+	report := signedReports[1].Report
+	assert.Equal(t, reportLen, r.Offset)
+	assert.Equal(t, hex.EncodeToString(report.RVK), r.RVK)
+	assert.Equal(t, hex.EncodeToString(report.TCKBytes[:]), r.TCK)
+	assert.Equal(t, uint16(1), r.J1)
+	assert.Equal(t, uint16(2), r.J2)
+	assert.Equal(t, "0x2", r.MemoType)
+	assert.Equal(t, "ito", r.MemoTypeName)
+	assert.Equal(t, hex.EncodeToString(testMemoData), r.MemoData)
+	assert.Empty(t, r.MemoError)
+	memo, err := tcn.DecodeITOMemo(testMemoData)
+	assert.NoError(t, err)
+	assert.Equal(t, memo, r.Memo)
+	assert.True(t, r.SignatureValid)
+
+	tcns, err := report.TemporaryContactNumbers()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(r.TCNs))
+	assert.Equal(t, hex.EncodeToString(tcns[0][:]), r.TCNs[0])
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, writeInspection(buf, result, false))
+	assert.Contains(t, buf.String(), "rvk:        "+r.RVK)
+	assert.Contains(t, buf.String(), "signature:  valid")
+
+	buf.Reset()
+	assert.NoError(t, writeInspection(buf, result, true))
+	decoded := map[string][]map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, r.Sig, decoded["reports"][1]["sig"])
+	assert.Equal(t, true, decoded["reports"][1]["signature_valid"])
+
+	signedReports[0].Sig[0] ^= 0xff
+	b, _ := signedReports[0].Bytes()
+	assert.False(t, inspectReports(b).Reports[0].SignatureValid)
+}
+
+func TestVerifyReports(t *testing.T) {
+	signedReports := generateSignedReports(t, 3)
+	signedReports[1].Sig[0] ^= 0xff
+	data := []byte{}
+	for _, sr := range signedReports {
+		data, _ = sr.AppendBytes(data)
+	}
+
+	result := verifyReports(data, DefaultConfig())
+	assert.Equal(t, 2, result.Valid)
+	assert.Equal(t, 1, result.Invalid)
+	assert.True(t, result.Reports[0].Valid)
+	assert.False(t, result.Reports[1].Valid)
+	assert.Equal(t, reportVerificationError, result.Reports[1].Error)
+
+	// Reports are checked with the given configuration.
+	config := DefaultConfig()
+	config.MemoTypes = []uint8{tcn.CoEpiMemoCode}
+	result = verifyReports(data, config)
+	assert.Equal(t, 0, result.Valid)
+	assert.Equal(t, memoTypeNotAcceptedError, result.Reports[0].Error)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, writeVerification(buf, result, false))
+	assert.True(t, strings.HasSuffix(buf.String(), "0 valid, 3 invalid\n"))
+}
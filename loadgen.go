@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ito-org/go-backend/tcn"
+)
+
+const (
+	// pollModeCursor polls downloads with 'after' and 'limit'.
+	pollModeCursor = "cursor"
+	// pollModeFrom polls downloads with 'from', like older clients.
+	pollModeFrom = "from"
+
+	// loadgenMaxSpan is the maximum number of keys of a generated report,
+	// i.e. 14 days of TCNs rotated every 15 minutes.
+	loadgenMaxSpan = 14 * 24 * 4
+)
+
+// loadSettings configure a load test.
+type loadSettings struct {
+	// Target is the base URL of the server, e.g. http://localhost:8080 or
+	// http://localhost:8080/t/rki for a tenant.
+	Target string
+	// Rate is the number of uploads per second, Concurrency the maximum
+	// number of concurrent uploads.
+	Rate        float64
+	Concurrency int
+	Duration    time.Duration
+	// Pollers is the number of simulated clients that download new reports
+	// every PollInterval, with the parameters of PollMode.
+	Pollers      int
+	PollInterval time.Duration
+	PollMode     string
+	// Decoy marks uploads as decoys so that they aren't stored.
+	Decoy bool
+}
+
+// validate returns an error if the settings can't be used.
+func (s *loadSettings) validate() error {
+	if _, err := url.ParseRequestURI(s.Target); err != nil {
+		return fmt.Errorf("Invalid target: %s", err.Error())
+	}
+	if !(s.Rate > 0) {
+		return errors.New("--rate must be positive")
+	}
+	if s.uploadInterval() <= 0 {
+		return fmt.Errorf("--rate must be at most %g", float64(time.Second))
+	}
+	if s.Concurrency <= 0 {
+		return errors.New("--concurrency must be positive")
+	}
+	if s.Duration <= 0 {
+		return errors.New("--duration must be positive")
+	}
+	if s.Pollers < 0 {
+		return errors.New("--pollers must not be negative")
+	}
+	if s.Pollers > 0 && s.PollInterval <= 0 {
+		return errors.New("--poll-interval must be positive")
+	}
+	if s.PollMode != pollModeCursor && s.PollMode != pollModeFrom {
+		return fmt.Errorf("Invalid poll mode: %s", s.PollMode)
+	}
+	return nil
+}
+
+// uploadInterval returns the interval between two uploads.
+func (s *loadSettings) uploadInterval() time.Duration {
+	return time.Duration(float64(time.Second) / s.Rate)
+}
+
+// latencyRecorder collects the latencies and results of one kind of request.
+type latencyRecorder struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+	statuses  map[int]int
+}
+
+func newLatencyRecorder() *latencyRecorder {
+	return &latencyRecorder{statuses: map[int]int{}}
+}
+
+// record adds a request that took d. status is 0 if the request failed
+// without response. Requests without 2xx response count as errors.
+func (r *latencyRecorder) record(d time.Duration, status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencies = append(r.latencies, d)
+	r.statuses[status]++
+	if status < 200 || status >= 300 {
+		r.errors++
+	}
+}
+
+// latencySummary summarizes the requests of a latencyRecorder. Latencies are
+// in milliseconds.
+type latencySummary struct {
+	Requests  int         `json:"requests"`
+	Errors    int         `json:"errors"`
+	ErrorRate float64     `json:"error_rate"`
+	Statuses  map[int]int `json:"statuses"`
+	P50       float64     `json:"p50_ms"`
+	P90       float64     `json:"p90_ms"`
+	P99       float64     `json:"p99_ms"`
+	Max       float64     `json:"max_ms"`
+}
+
+func (r *latencyRecorder) summary() *latencySummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := &latencySummary{
+		Requests: len(r.latencies),
+		Errors:   r.errors,
+		Statuses: map[int]int{},
+	}
+	for status, n := range r.statuses {
+		s.Statuses[status] = n
+	}
+	if len(r.latencies) == 0 {
+		return s
+	}
+
+	sorted := make([]time.Duration, len(r.latencies))
+	copy(sorted, r.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	s.ErrorRate = float64(r.errors) / float64(len(sorted))
+	s.P50 = milliseconds(percentile(sorted, 50))
+	s.P90 = milliseconds(percentile(sorted, 90))
+	s.P99 = milliseconds(percentile(sorted, 99))
+	s.Max = milliseconds(sorted[len(sorted)-1])
+	return s
+}
+
+// percentile returns the p-th percentile of sorted with the nearest-rank
+// method. sorted must not be empty.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// loadSummary is the result of a load test.
+type loadSummary struct {
+	Duration float64 `json:"duration_s"`
+	// Skipped is the number of uploads that weren't sent because all
+	// workers were busy, i.e. the server couldn't keep up with the rate.
+	Skipped   int             `json:"skipped_uploads"`
+	Uploads   *latencySummary `json:"uploads"`
+	Downloads *latencySummary `json:"downloads"`
+	// Received is the number of reports downloaded by the pollers.
+	Received int `json:"received_reports"`
+}
+
+// loadGenerator uploads generated reports to a server and polls its
+// downloads.
+type loadGenerator struct {
+	settings  *loadSettings
+	client    *http.Client
+	uploads   *latencyRecorder
+	downloads *latencyRecorder
+
+	mu       sync.Mutex
+	skipped  int
+	received int
+}
+
+func newLoadGenerator(settings *loadSettings) *loadGenerator {
+	return &loadGenerator{
+		settings: settings,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost: settings.Concurrency + settings.Pollers,
+			},
+		},
+		uploads:   newLatencyRecorder(),
+		downloads: newLatencyRecorder(),
+	}
+}
+
+// run generates load for the configured duration or until ctx is done.
+// Requests that are in flight when the duration is over are completed.
+func (g *loadGenerator) run(ctx context.Context) *loadSummary {
+	start := time.Now()
+	deadline, cancel := context.WithTimeout(ctx, g.settings.Duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	// Jobs are only handed to idle workers, so no queued uploads are left to
+	// be sent after the deadline.
+	jobs := make(chan struct{})
+	for i := 0; i < g.settings.Concurrency; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for range jobs {
+				g.upload(ctx, rng)
+			}
+		}(start.UnixNano() + int64(i))
+	}
+	for i := 0; i < g.settings.Pollers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.poll(ctx, deadline.Done())
+		}()
+	}
+
+	ticker := time.NewTicker(g.settings.uploadInterval())
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-deadline.Done():
+			break loop
+		case <-ticker.C:
+			select {
+			case jobs <- struct{}{}:
+			default:
+				g.mu.Lock()
+				g.skipped++
+				g.mu.Unlock()
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return &loadSummary{
+		Duration:  time.Since(start).Seconds(),
+		Skipped:   g.skipped,
+		Uploads:   g.uploads.summary(),
+		Downloads: g.downloads.summary(),
+		Received:  g.received,
+	}
+}
+
+// generateLoadReport returns a signed ito report with random key indices
+// and memo.
+func generateLoadReport(rng *rand.Rand) (*tcn.SignedReport, error) {
+	memo := &tcn.ITOMemo{
+		Version:     tcn.ITOMemoVersion,
+		Kind:        tcn.ITOReportSymptoms,
+		OnsetBucket: uint16(time.Now().Unix()/86400) - uint16(rng.Intn(14)),
+		Symptoms:    tcn.ITOSymptoms(1 + rng.Intn(int(tcn.ITOSymptomsAll))),
+	}
+	if rng.Intn(2) == 0 {
+		memo.Kind = tcn.ITOReportVerifiedTest
+		memo.VerificationToken = make([]byte, 16)
+		rng.Read(memo.VerificationToken)
+	}
+	memoData, err := memo.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	j1 := uint16(1 + rng.Intn(loadgenMaxSpan))
+	j2 := j1 + uint16(1+rng.Intn(loadgenMaxSpan))
+	_, rak, report, err := tcn.GenerateReport(j1, j2, memoData)
+	if err != nil {
+		return nil, err
+	}
+	return tcn.GenerateSignedReport(rak, report)
+}
+
+// upload uploads one generated report.
+func (g *loadGenerator) upload(ctx context.Context, rng *rand.Rand) {
+	signedReport, err := generateLoadReport(rng)
+	if err != nil {
+		g.uploads.record(0, 0)
+		return
+	}
+	b, err := signedReport.Bytes()
+	if err != nil {
+		g.uploads.record(0, 0)
+		return
+	}
+
+	req, err := http.NewRequest("POST", g.settings.Target+"/tcnreport", bytes.NewReader(b))
+	if err != nil {
+		g.uploads.record(0, 0)
+		return
+	}
+	if g.settings.Decoy {
+		req.Header.Set(decoyHeader, "1")
+	} else {
+		req.Header.Set(decoyHeader, "0")
+	}
+
+	start := time.Now()
+	status, _, _ := g.do(ctx, req)
+	g.uploads.record(time.Since(start), status)
+}
+
+// poll downloads new reports every poll interval until done is closed.
+func (g *loadGenerator) poll(ctx context.Context, done <-chan struct{}) {
+	var cursor string
+	var from string
+
+	ticker := time.NewTicker(g.settings.PollInterval)
+	defer ticker.Stop()
+	for {
+		if g.settings.PollMode == pollModeCursor {
+			cursor = g.downloadPages(ctx, done, cursor)
+		} else {
+			from = g.downloadFrom(ctx, from)
+		}
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// downloadPages downloads all pages after cursor, until done is closed, and
+// returns the cursor of the last page.
+func (g *loadGenerator) downloadPages(ctx context.Context, done <-chan struct{}, cursor string) string {
+	if cursor == "" {
+		cursor = "0"
+	}
+	for {
+		select {
+		case <-done:
+			return cursor
+		default:
+		}
+
+		req, err := http.NewRequest("GET", g.settings.Target+"/tcnreport?limit="+strconv.Itoa(maxListLimit)+"&after="+cursor, nil)
+		if err != nil {
+			g.downloads.record(0, 0)
+			return cursor
+		}
+
+		start := time.Now()
+		status, header, reports := g.do(ctx, req)
+		g.downloads.record(time.Since(start), status)
+		next := header.Get(nextCursorHeader)
+		if status != http.StatusOK || len(reports) == 0 || next == "" {
+			return cursor
+		}
+		cursor = next
+	}
+}
+
+// downloadFrom downloads the reports after the report from, which is hex
+// encoded, and returns the last downloaded report.
+func (g *loadGenerator) downloadFrom(ctx context.Context, from string) string {
+	path := g.settings.Target + "/tcnreport"
+	if from != "" {
+		path += "?from=" + from
+	}
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		g.downloads.record(0, 0)
+		return from
+	}
+
+	start := time.Now()
+	status, _, reports := g.do(ctx, req)
+	g.downloads.record(time.Since(start), status)
+	if len(reports) == 0 {
+		return from
+	}
+	b, err := reports[len(reports)-1].Report.Bytes()
+	if err != nil {
+		return from
+	}
+	return hex.EncodeToString(b)
+}
+
+// do sends req and returns the response status, header and, for downloads,
+// the received signed reports. The status is 0 if there was no response.
+func (g *loadGenerator) do(ctx context.Context, req *http.Request) (int, http.Header, []*tcn.SignedReport) {
+	resp, err := g.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, http.Header{}, nil
+	}
+	defer resp.Body.Close()
+
+	if req.Method != "GET" || resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return resp.StatusCode, resp.Header, nil
+	}
+
+	reports := []*tcn.SignedReport{}
+	dec := tcn.NewDecoder(resp.Body)
+	for {
+		sr := &tcn.SignedReport{}
+		if err := dec.Decode(sr); err == io.EOF {
+			break
+		} else if err != nil {
+			// Broken downloads count as errors.
+			return 0, resp.Header, nil
+		}
+		reports = append(reports, sr)
+	}
+	g.mu.Lock()
+	g.received += len(reports)
+	g.mu.Unlock()
+	return resp.StatusCode, resp.Header, reports
+}
+
+// writeLoadSummary writes s to w as JSON or as text.
+func writeLoadSummary(w io.Writer, s *loadSummary, asJSON bool) error {
+	if asJSON {
+		return writeJSON(w, s)
+	}
+
+	fmt.Fprintf(w, "Duration: %.1fs\n", s.Duration)
+	for _, r := range []struct {
+		name    string
+		summary *latencySummary
+	}{
+		{"Uploads", s.Uploads},
+		{"Downloads", s.Downloads},
+	} {
+		fmt.Fprintf(w, "%s: %d requests, %d errors (%.2f%%)\n", r.name, r.summary.Requests, r.summary.Errors, 100*r.summary.ErrorRate)
+		if r.summary.Requests > 0 {
+			fmt.Fprintf(
+				w, "  latency: p50 %.1fms, p90 %.1fms, p99 %.1fms, max %.1fms\n",
+				r.summary.P50, r.summary.P90, r.summary.P99, r.summary.Max,
+			)
+		}
+		statuses := make([]int, 0, len(r.summary.Statuses))
+		for status := range r.summary.Statuses {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+		for _, status := range statuses {
+			name := strconv.Itoa(status)
+			if status == 0 {
+				name = "no response"
+			}
+			fmt.Fprintf(w, "  %s: %d\n", name, r.summary.Statuses[status])
+		}
+	}
+	fmt.Fprintf(w, "Skipped uploads: %d\n", s.Skipped)
+	fmt.Fprintf(w, "Received reports: %d\n", s.Received)
+	return nil
+}
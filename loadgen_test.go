@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeReportServer serves uploads and downloads from memory, with the
+// validation of the real server.
+type fakeReportServer struct {
+	mu      sync.Mutex
+	reports []*tcn.SignedReport
+	// fromRequests counts downloads with 'from'.
+	fromRequests int
+}
+
+func (s *fakeReportServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == "POST" {
+		data, _ := ioutil.ReadAll(r.Body)
+		sr, err := tcn.GetSignedReport(data)
+		if err == nil {
+			err = validateSignedReport(DefaultConfig(), sr)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get(decoyHeader) != "1" {
+			s.reports = append(s.reports, sr)
+		}
+		return
+	}
+
+	start := 0
+	if from := r.URL.Query().Get("from"); from != "" {
+		s.fromRequests++
+		b, _ := hex.DecodeString(from)
+		for i, sr := range s.reports {
+			rb, _ := sr.Report.Bytes()
+			if bytes.Equal(rb, b) {
+				start = i + 1
+			}
+		}
+	} else if after := r.URL.Query().Get("after"); after != "" {
+		start, _ = strconv.Atoi(after)
+		w.Header().Set(nextCursorHeader, strconv.Itoa(len(s.reports)))
+	}
+	enc := tcn.NewEncoder(w)
+	for _, sr := range s.reports[start:] {
+		_ = enc.Encode(sr)
+	}
+}
+
+func TestLoadGenerator(t *testing.T) {
+	for _, mode := range []string{pollModeCursor, pollModeFrom} {
+		fake := &fakeReportServer{}
+		server := httptest.NewServer(fake)
+
+		settings := &loadSettings{
+			Target:       server.URL,
+			Rate:         100,
+			Concurrency:  4,
+			Duration:     300 * time.Millisecond,
+			Pollers:      2,
+			PollInterval: 50 * time.Millisecond,
+			PollMode:     mode,
+		}
+		assert.NoError(t, settings.validate())
+		summary := newLoadGenerator(settings).run(context.Background())
+		server.Close()
+
+		assert.True(t, summary.Uploads.Requests > 0, mode)
+		assert.Equal(t, 0, summary.Uploads.Errors, mode)
+		assert.Equal(t, summary.Uploads.Requests, summary.Uploads.Statuses[http.StatusOK], mode)
+		assert.Equal(t, len(fake.reports), summary.Uploads.Requests, mode)
+		assert.True(t, summary.Uploads.P50 <= summary.Uploads.P99, mode)
+		assert.True(t, summary.Downloads.Requests > 0, mode)
+		assert.Equal(t, 0, summary.Downloads.Errors, mode)
+		assert.True(t, summary.Received > 0, mode)
+		if mode == pollModeFrom {
+			assert.True(t, fake.fromRequests > 0)
+		}
+	}
+}
+
+func TestLoadGeneratorDeadline(t *testing.T) {
+	const latency = 100 * time.Millisecond
+	var mu sync.Mutex
+	var uploadStarts []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			mu.Lock()
+			uploadStarts = append(uploadStarts, time.Now())
+			mu.Unlock()
+		}
+		time.Sleep(latency)
+	}))
+	defer server.Close()
+
+	settings := &loadSettings{
+		Target:       server.URL,
+		Rate:         1000,
+		Concurrency:  2,
+		Duration:     250 * time.Millisecond,
+		PollInterval: time.Second,
+		PollMode:     pollModeCursor,
+	}
+	assert.NoError(t, settings.validate())
+	start := time.Now()
+	summary := newLoadGenerator(settings).run(context.Background())
+
+	// Uploads are only started before the deadline, and the workers being
+	// busy shows up as skipped uploads.
+	assert.True(t, summary.Uploads.Requests > 0)
+	assert.True(t, summary.Skipped > 0)
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range uploadStarts {
+		assert.True(t, s.Sub(start) < settings.Duration+latency/2, s.Sub(start))
+	}
+}
+
+func TestLoadGeneratorErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	settings := &loadSettings{
+		Target:      server.URL,
+		Rate:        100,
+		Concurrency: 2,
+		Duration:    100 * time.Millisecond,
+		PollMode:    pollModeCursor,
+		Decoy:       true,
+	}
+	summary := newLoadGenerator(settings).run(context.Background())
+	assert.True(t, summary.Uploads.Requests > 0)
+	assert.Equal(t, summary.Uploads.Requests, summary.Uploads.Errors)
+	assert.Equal(t, 1.0, summary.Uploads.ErrorRate)
+	assert.Equal(t, 0, summary.Downloads.Requests)
+}
+
+func TestGenerateLoadReport(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		sr, err := generateLoadReport(rng)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.NoError(t, validateSignedReport(DefaultConfig(), sr))
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		latencies[i] = time.Duration(i+1) * time.Millisecond
+	}
+	assert.Equal(t, 50*time.Millisecond, percentile(latencies, 50))
+	assert.Equal(t, 99*time.Millisecond, percentile(latencies, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(latencies, 100))
+	assert.Equal(t, time.Millisecond, percentile(latencies[:1], 99))
+}
+
+func TestLoadSettingsValidate(t *testing.T) {
+	valid := loadSettings{
+		Target:       "http://localhost:8080",
+		Rate:         1,
+		Concurrency:  1,
+		Duration:     time.Second,
+		Pollers:      1,
+		PollInterval: time.Second,
+		PollMode:     pollModeCursor,
+	}
+	assert.NoError(t, valid.validate())
+
+	// One upload per nanosecond is the highest rate a ticker supports.
+	fastest := valid
+	fastest.Rate = 1e9
+	assert.NoError(t, fastest.validate())
+
+	for _, modify := range []func(s *loadSettings){
+		func(s *loadSettings) { s.Target = "localhost" },
+		func(s *loadSettings) { s.Rate = 0 },
+		func(s *loadSettings) { s.Rate = 2e9 },
+		func(s *loadSettings) { s.Rate = math.Inf(1) },
+		func(s *loadSettings) { s.Rate = math.NaN() },
+		func(s *loadSettings) { s.Concurrency = 0 },
+		func(s *loadSettings) { s.Duration = 0 },
+		func(s *loadSettings) { s.PollInterval = 0 },
+		func(s *loadSettings) { s.PollMode = "push" },
+	} {
+		s := valid
+		modify(&s)
+		assert.Error(t, s.validate())
+	}
+}
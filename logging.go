@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Client IP modes of the request logger.
+const (
+	// logIPNone doesn't log client IPs.
+	logIPNone = "none"
+	// logIPTruncated logs the /24 network of IPv4 and the /48 network of
+	// IPv6 addresses.
+	logIPTruncated = "truncated"
+	// logIPHashed logs a keyed hash of the IP. The key is generated at
+	// startup, so hashes can only be correlated until the server restarts.
+	logIPHashed = "hashed"
+)
+
+// Output formats of the request logger.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// validateLogSettings checks the log settings of config.
+func validateLogSettings(config *Config) error {
+	switch config.LogIPMode {
+	case logIPNone, logIPTruncated, logIPHashed:
+	default:
+		return fmt.Errorf("Unsupported log IP mode: %s", config.LogIPMode)
+	}
+	switch config.LogFormat {
+	case logFormatText, logFormatJSON:
+	default:
+		return fmt.Errorf("Unsupported log format: %s", config.LogFormat)
+	}
+	return nil
+}
+
+// requestLogEntry is a single line of the request log.
+type requestLogEntry struct {
+	Time    time.Time `json:"time"`
+	Method  string    `json:"method"`
+	Route   string    `json:"route"`
+	Status  int       `json:"status"`
+	Latency float64   `json:"latency_ms"`
+	Size    int       `json:"size"`
+	IP      string    `json:"ip,omitempty"`
+}
+
+// requestLogger returns a middleware that writes a line to out for every
+// request. Only the route template is logged, never the actual path or the
+// query string, as both may contain report data. Client IPs are logged as
+// configured by config.LogIPMode.
+func requestLogger(config *Config, out io.Writer) (gin.HandlerFunc, error) {
+	if err := validateLogSettings(config); err != nil {
+		return nil, err
+	}
+
+	var hashKey []byte
+	if config.LogIPMode == logIPHashed {
+		hashKey = make([]byte, sha256.Size)
+		if _, err := rand.Read(hashKey); err != nil {
+			return nil, err
+		}
+	}
+
+	var mu sync.Mutex
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		entry := &requestLogEntry{
+			Time:    start,
+			Method:  c.Request.Method,
+			Route:   c.FullPath(),
+			Status:  c.Writer.Status(),
+			Latency: float64(time.Since(start)) / float64(time.Millisecond),
+			Size:    c.Writer.Size(),
+		}
+		switch config.LogIPMode {
+		case logIPTruncated:
+			entry.IP = truncateIP(c.ClientIP())
+		case logIPHashed:
+			entry.IP = hashIP(hashKey, c.ClientIP())
+		}
+		if entry.Route == "" {
+			entry.Route = "unknown"
+		}
+
+		var line []byte
+		if config.LogFormat == logFormatJSON {
+			var err error
+			if line, err = json.Marshal(entry); err != nil {
+				return
+			}
+			line = append(line, '\n')
+		} else {
+			line = []byte(entry.text())
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = out.Write(line)
+	}, nil
+}
+
+// text returns the entry in a format similar to Gin's default logger.
+func (e *requestLogEntry) text() string {
+	ip := ""
+	if e.IP != "" {
+		ip = fmt.Sprintf(" %s |", e.IP)
+	}
+	return fmt.Sprintf(
+		"%s | %3d | %10.3fms |%s %-7s %s\n",
+		e.Time.Format("2006/01/02 - 15:04:05"),
+		e.Status,
+		e.Latency,
+		ip,
+		e.Method,
+		e.Route,
+	)
+}
+
+// truncateIP returns the /24 network of IPv4 and the /48 network of IPv6
+// addresses.
+func truncateIP(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// hashIP returns a hex encoded keyed hash of the IP s.
+func hashIP(key []byte, s string) string {
+	if s == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// recovery returns a middleware that recovers from panics and responds with
+// status 500. Unlike gin.Recovery, it doesn't log the request, which contains
+// the query string and the client IP.
+func recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if err := recover(); err != nil {
+				fmt.Fprintf(os.Stderr, "Panic recovered in %s %s: %v\n%s", c.Request.Method, c.FullPath(), err, debug.Stack())
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLogger(t *testing.T) {
+	const query = "from=deadbeef"
+
+	for _, tc := range []struct {
+		ipMode string
+		format string
+		ip     string
+	}{
+		{logIPNone, logFormatText, ""},
+		{logIPTruncated, logFormatText, "192.0.2.0"},
+		{logIPNone, logFormatJSON, ""},
+		{logIPTruncated, logFormatJSON, "192.0.2.0"},
+		{logIPHashed, logFormatJSON, ""},
+	} {
+		config := DefaultConfig()
+		config.LogIPMode = tc.ipMode
+		config.LogFormat = tc.format
+
+		var out bytes.Buffer
+		logger, err := requestLogger(config, &out)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		r := gin.New()
+		r.Use(logger)
+		r.GET("/tcnreport", func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/tcnreport?"+query, nil)
+		req.RemoteAddr = "192.0.2.33:1234"
+		r.ServeHTTP(rec, req)
+
+		line := out.String()
+		assert.True(t, strings.HasSuffix(line, "\n"))
+		assert.NotContains(t, line, "deadbeef")
+		assert.NotContains(t, line, "192.0.2.33")
+		assert.Contains(t, line, "/tcnreport")
+
+		if tc.format != logFormatJSON {
+			if tc.ip != "" {
+				assert.Contains(t, line, tc.ip)
+			}
+			continue
+		}
+
+		var entry requestLogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, "GET", entry.Method)
+		assert.Equal(t, "/tcnreport", entry.Route)
+		assert.Equal(t, http.StatusOK, entry.Status)
+		switch tc.ipMode {
+		case logIPHashed:
+			assert.Len(t, entry.IP, 16)
+		default:
+			assert.Equal(t, tc.ip, entry.IP)
+		}
+	}
+}
+
+func TestTruncateIP(t *testing.T) {
+	assert.Equal(t, "192.0.2.0", truncateIP("192.0.2.33"))
+	assert.Equal(t, "2001:db8:1::", truncateIP("2001:db8:1:2::1"))
+	assert.Equal(t, "", truncateIP("invalid"))
+}
+
+func TestValidateLogSettings(t *testing.T) {
+	config := DefaultConfig()
+	assert.NoError(t, validateLogSettings(config))
+
+	config.LogIPMode = "full"
+	assert.Error(t, validateLogSettings(config))
+
+	config = DefaultConfig()
+	config.LogFormat = "xml"
+	assert.Error(t, validateLogSettings(config))
+}
+
+func TestRecovery(t *testing.T) {
+	r := gin.New()
+	r.Use(recovery())
+	r.GET("/panic", func(c *gin.Context) {
+		panic("test")
+	})
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"math"
+	"net"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/urfave/cli"
 )
@@ -29,8 +36,112 @@ func readPostgresSettings() (dbHost, dbName, dbUser, dbPassword string) {
 	return
 }
 
+// readPostgresTLSSettings reads the TLS settings for the database connection.
+// TLS is disabled if POSTGRES_SSLMODE isn't set.
+func readPostgresTLSSettings() *DBTLSSettings {
+	return &DBTLSSettings{
+		Mode:     os.Getenv("POSTGRES_SSLMODE"),
+		RootCert: os.Getenv("POSTGRES_SSLROOTCERT"),
+		Cert:     os.Getenv("POSTGRES_SSLCERT"),
+		Key:      os.Getenv("POSTGRES_SSLKEY"),
+	}
+}
+
+// connectDB connects to the database given by the environment variables.
+func connectDB() (*DBConnection, error) {
+	dbHost, dbName, dbUser, dbPassword := readPostgresSettings()
+	return NewDBConnection(dbHost, dbUser, dbPassword, dbName, readPostgresTLSSettings())
+}
+
+// tenantConfig returns the configuration of the tenant with the given ID in
+// the tenant file. Without tenant file, the tenant ID must be empty and base
+// is returned.
+func tenantConfig(base *Config, tenantFile, tenantID string) (*Config, error) {
+	if tenantFile == "" {
+		if tenantID != "" {
+			return nil, errors.New("--tenant requires --tenants")
+		}
+		return base, nil
+	}
+	tenants, err := loadTenants(tenantFile, base)
+	if err != nil {
+		return nil, err
+	}
+	config, ok := tenants.byID[tenantID]
+	if !ok {
+		return nil, errors.New(unknownTenantError)
+	}
+	return config, nil
+}
+
 func main() {
-	var port string
+	var port, grpcPort string
+	var tlsCert, tlsKey, tlsClientCA string
+	var pgNotify bool
+	var memoTypes string
+	var maxKeySpan uint
+	var retention time.Duration
+	var paddingBucketSize int
+	var logIPMode, logFormat string
+	var statsEpsilon float64
+	var statsDays int
+	var statsOutput, statsRegion string
+	var regions string
+	var verificationIssuers, signingKey string
+	var tenantFile, tenantID string
+	var backupFile string
+	var backupGzip bool
+	var jsonOutput bool
+	load := &loadSettings{}
+	var seedCount int
+	var seedValue int64
+	var seedStart, seedEnd, seedOutput string
+
+	// readConfig returns the configuration given by the global flags.
+	readConfig := func() (*Config, error) {
+		config := DefaultConfig()
+		var err error
+		config.MemoTypes, err = parseMemoTypes([]string{memoTypes})
+		if err != nil {
+			return nil, err
+		}
+		if len(config.MemoTypes) == 0 {
+			return nil, errors.New("At least one memo type must be accepted")
+		}
+		config.Regions = parseRegions([]string{regions})
+		if maxKeySpan > math.MaxUint16 {
+			return nil, errors.New("--max-key-span must not exceed 65535")
+		}
+		config.MaxKeySpan = uint16(maxKeySpan)
+		if retention < 0 {
+			return nil, errors.New("--retention must not be negative")
+		}
+		config.Retention = retention
+		if paddingBucketSize < 0 {
+			return nil, errors.New("--padding-bucket-size must not be negative")
+		}
+		config.PaddingBucketSize = paddingBucketSize
+		config.LogIPMode = logIPMode
+		config.LogFormat = logFormat
+		if err := validateLogSettings(config); err != nil {
+			return nil, err
+		}
+		if statsEpsilon <= 0 {
+			return nil, errors.New("--stats-epsilon must be positive")
+		}
+		config.StatsEpsilon = statsEpsilon
+		config.VerificationIssuers, err = parseVerificationIssuers([]string{verificationIssuers})
+		if err != nil {
+			return nil, err
+		}
+		if signingKey != "" {
+			config.SigningKey, err = readSigningKey(signingKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return config, nil
+	}
 
 	app := &cli.App{
 		Flags: []cli.Flag{
@@ -40,18 +151,532 @@ func main() {
 				Usage:       "Port for the server to run on",
 				Destination: &port,
 			},
+			&cli.StringFlag{
+				Name:        "grpc-port",
+				Usage:       "Port for the gRPC report service; disabled if empty",
+				Destination: &grpcPort,
+			},
+			&cli.StringFlag{
+				Name:        "tls-cert",
+				Usage:       "TLS certificate file; enables HTTPS together with --tls-key. Reloaded on SIGHUP",
+				Destination: &tlsCert,
+			},
+			&cli.StringFlag{
+				Name:        "tls-key",
+				Usage:       "TLS private key file; reloaded on SIGHUP",
+				Destination: &tlsKey,
+			},
+			&cli.StringFlag{
+				Name:        "tls-client-ca",
+				Usage:       "CA file for verifying client certificates on the federation routes",
+				Destination: &tlsClientCA,
+			},
+			&cli.StringFlag{
+				Name:        "memo-types",
+				Value:       "0x2",
+				Usage:       "Comma separated list of accepted memo types",
+				Destination: &memoTypes,
+			},
+			&cli.StringFlag{
+				Name:        "regions",
+				Usage:       "Comma separated list of regions reports may be uploaded for",
+				Destination: &regions,
+			},
+			&cli.StringFlag{
+				Name:        "verification-issuers",
+				Usage:       "Comma separated list of base64 Ed25519 public keys whose signatures of the RVK are accepted as verification tokens",
+				Destination: &verificationIssuers,
+			},
+			&cli.StringFlag{
+				Name:        "signing-key",
+				Usage:       "File with the base64 Ed25519 seed that signs report downloads",
+				Destination: &signingKey,
+			},
+			&cli.UintFlag{
+				Name:        "max-key-span",
+				Value:       defaultMaxKeySpan,
+				Usage:       "Maximum number of keys a report may cover (j2 - j1)",
+				Destination: &maxKeySpan,
+			},
+			&cli.DurationFlag{
+				Name:        "retention",
+				Value:       defaultRetention,
+				Usage:       "Time reports are served for after they were received; earlier 'since' timestamps are clamped. 0 disables the limit",
+				Destination: &retention,
+			},
+			&cli.IntFlag{
+				Name:        "padding-bucket-size",
+				Value:       defaultPaddingBucketSize,
+				Usage:       "Pad upload responses to a multiple of this many bytes; 0 disables padding",
+				Destination: &paddingBucketSize,
+			},
+			&cli.StringFlag{
+				Name:        "log-ip",
+				Value:       logIPNone,
+				Usage:       "How client IPs are logged: none, truncated or hashed",
+				Destination: &logIPMode,
+			},
+			&cli.StringFlag{
+				Name:        "log-format",
+				Value:       logFormatText,
+				Usage:       "Request log format: text or json",
+				Destination: &logFormat,
+			},
+			&cli.Float64Flag{
+				Name:        "stats-epsilon",
+				Value:       defaultStatsEpsilon,
+				Usage:       "Privacy budget spent on the statistics of a day; smaller values add more noise",
+				Destination: &statsEpsilon,
+			},
+			&cli.StringFlag{
+				Name:        "tenants",
+				Usage:       "JSON file with the tenants served by this instance; a single tenant if empty",
+				Destination: &tenantFile,
+			},
+			&cli.BoolFlag{
+				Name:        "pg-notify",
+				Usage:       "Distribute new reports between replicas with Postgres LISTEN/NOTIFY",
+				Destination: &pgNotify,
+			},
+		},
+		Commands: []cli.Command{
+			{
+				Name:  "stats",
+				Usage: "Export the differentially private daily statistics as CSV",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:        "days",
+						Value:       defaultStatsDays,
+						Usage:       "Number of days before today to export",
+						Destination: &statsDays,
+					},
+					&cli.StringFlag{
+						Name:        "region",
+						Usage:       "Region to export; all regions if empty",
+						Destination: &statsRegion,
+					},
+					&cli.StringFlag{
+						Name:        "tenant",
+						Usage:       "Tenant from --tenants to export",
+						Destination: &tenantID,
+					},
+					&cli.StringFlag{
+						Name:        "output",
+						Usage:       "CSV file to write; stdout if empty",
+						Destination: &statsOutput,
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					config, err := readConfig()
+					if err != nil {
+						return err
+					}
+					config, err = tenantConfig(config, tenantFile, tenantID)
+					if err != nil {
+						return err
+					}
+					if statsDays <= 0 || statsDays > maxStatsDays {
+						return errors.New(invalidDaysError)
+					}
+					if statsRegion != "" && !config.acceptsRegion(statsRegion) {
+						return errors.New(unknownRegionError)
+					}
+					dbConnection, err := connectDB()
+					if err != nil {
+						return err
+					}
+					stats, err := dbConnection.getLastDailyStats(statsDays, statsRegion, config)
+					if err != nil {
+						return err
+					}
+
+					if statsOutput == "" {
+						return writeStatsCSV(os.Stdout, stats, config)
+					}
+					f, err := os.Create(statsOutput)
+					if err != nil {
+						return err
+					}
+					if err := writeStatsCSV(f, stats, config); err != nil {
+						_ = f.Close()
+						return err
+					}
+					return f.Close()
+				},
+			},
+			{
+				Name:  "export",
+				Usage: "Export the signed reports in the TCN wire format together with a JSON manifest",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "output",
+						Usage:       "File to write; the manifest is written to <output>" + manifestSuffix,
+						Destination: &backupFile,
+					},
+					&cli.BoolFlag{
+						Name:        "gzip",
+						Usage:       "Compress the reports with gzip",
+						Destination: &backupGzip,
+					},
+					&cli.StringFlag{
+						Name:        "tenant",
+						Usage:       "Tenant from --tenants to export",
+						Destination: &tenantID,
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if backupFile == "" {
+						return errors.New("--output is required")
+					}
+					config, err := readConfig()
+					if err != nil {
+						return err
+					}
+					config, err = tenantConfig(config, tenantFile, tenantID)
+					if err != nil {
+						return err
+					}
+					dbConnection, err := connectDB()
+					if err != nil {
+						return err
+					}
+					manifest, err := dbConnection.exportFile(backupFile, config.TenantID, backupGzip)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("Exported %d signed reports to %s\n", manifest.Count, backupFile)
+					return nil
+				},
+			},
+			{
+				Name:  "import",
+				Usage: "Import signed reports written by export, skipping invalid and already stored reports",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "input",
+						Usage:       "File to read; its checksum is verified if <input>" + manifestSuffix + " exists",
+						Destination: &backupFile,
+					},
+					&cli.BoolFlag{
+						Name:        "gzip",
+						Usage:       "The reports are compressed with gzip; only used without manifest",
+						Destination: &backupGzip,
+					},
+					&cli.StringFlag{
+						Name:        "tenant",
+						Usage:       "Tenant from --tenants to import into",
+						Destination: &tenantID,
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if backupFile == "" {
+						return errors.New("--input is required")
+					}
+					config, err := readConfig()
+					if err != nil {
+						return err
+					}
+					config, err = tenantConfig(config, tenantFile, tenantID)
+					if err != nil {
+						return err
+					}
+					dbConnection, err := connectDB()
+					if err != nil {
+						return err
+					}
+					result, err := dbConnection.importFile(backupFile, config, backupGzip)
+					if err != nil {
+						return err
+					}
+					fmt.Printf(
+						"Imported %d signed reports, skipped %d duplicates and %d invalid reports\n",
+						result.Imported, result.Duplicates, result.Invalid,
+					)
+					return nil
+				},
+			},
+			{
+				Name:  "seed",
+				Usage: "Store deterministic signed reports for development and write their keys and TCNs to a fixture file",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:        "count",
+						Value:       100,
+						Usage:       "Number of reports",
+						Destination: &seedCount,
+					},
+					&cli.Int64Flag{
+						Name:        "seed",
+						Value:       1,
+						Usage:       "Seed of the random number generator; the same seed generates the same reports",
+						Destination: &seedValue,
+					},
+					&cli.StringFlag{
+						Name:        "start",
+						Usage:       "Time the first report is received, RFC 3339 or unix seconds; 14 days ago if empty",
+						Destination: &seedStart,
+					},
+					&cli.StringFlag{
+						Name:        "end",
+						Usage:       "Time after the last report is received, RFC 3339 or unix seconds; now if empty",
+						Destination: &seedEnd,
+					},
+					&cli.StringFlag{
+						Name:        "output",
+						Usage:       "Fixture file with the reports, their keys and TCNs; not written if empty",
+						Destination: &seedOutput,
+					},
+					&cli.StringFlag{
+						Name:        "tenant",
+						Usage:       "Tenant from --tenants to store the reports for",
+						Destination: &tenantID,
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					config, err := readConfig()
+					if err != nil {
+						return err
+					}
+					config, err = tenantConfig(config, tenantFile, tenantID)
+					if err != nil {
+						return err
+					}
+
+					settings := &seedSettings{
+						Count:     seedCount,
+						Seed:      seedValue,
+						End:       time.Now().Truncate(time.Second),
+						MemoTypes: config.MemoTypes,
+						TenantID:  config.TenantID,
+					}
+					settings.Start = settings.End.AddDate(0, 0, -14)
+					if seedStart != "" {
+						if settings.Start, err = parseTime(seedStart); err != nil {
+							return err
+						}
+					}
+					if seedEnd != "" {
+						if settings.End, err = parseTime(seedEnd); err != nil {
+							return err
+						}
+					}
+					if err := settings.validate(); err != nil {
+						return err
+					}
+
+					fixture, err := generateSeed(settings)
+					if err != nil {
+						return err
+					}
+					dbConnection, err := connectDB()
+					if err != nil {
+						return err
+					}
+					if err := dbConnection.storeSeed(fixture); err != nil {
+						return err
+					}
+					if seedOutput != "" {
+						if err := writeSeedFixture(seedOutput, fixture); err != nil {
+							return err
+						}
+					}
+					fmt.Printf("Stored %d signed reports\n", len(fixture.Reports))
+					return nil
+				},
+			},
+			{
+				Name:  "loadgen",
+				Usage: "Upload generated reports to a server at a fixed rate while polling downloads and report latencies and errors",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "target",
+						Value:       "http://localhost:8080",
+						Usage:       "Base URL of the server, e.g. https://example.org/t/<tenant> for a tenant",
+						Destination: &load.Target,
+					},
+					&cli.Float64Flag{
+						Name:        "rate",
+						Value:       10,
+						Usage:       "Uploads per second",
+						Destination: &load.Rate,
+					},
+					&cli.IntFlag{
+						Name:        "concurrency",
+						Value:       10,
+						Usage:       "Maximum number of concurrent uploads",
+						Destination: &load.Concurrency,
+					},
+					&cli.DurationFlag{
+						Name:        "duration",
+						Value:       time.Minute,
+						Usage:       "Duration of the load test",
+						Destination: &load.Duration,
+					},
+					&cli.IntFlag{
+						Name:        "pollers",
+						Value:       10,
+						Usage:       "Number of simulated clients polling for new reports",
+						Destination: &load.Pollers,
+					},
+					&cli.DurationFlag{
+						Name:        "poll-interval",
+						Value:       5 * time.Second,
+						Usage:       "Time between the downloads of a polling client",
+						Destination: &load.PollInterval,
+					},
+					&cli.StringFlag{
+						Name:        "poll-mode",
+						Value:       pollModeCursor,
+						Usage:       "How clients poll: cursor ('after' and 'limit') or from",
+						Destination: &load.PollMode,
+					},
+					&cli.BoolFlag{
+						Name:        "decoy",
+						Usage:       "Mark uploads as decoys so that the server doesn't store them",
+						Destination: &load.Decoy,
+					},
+					&cli.BoolFlag{
+						Name:        "json",
+						Usage:       "Write JSON instead of text",
+						Destination: &jsonOutput,
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if err := load.validate(); err != nil {
+						return err
+					}
+					summary := newLoadGenerator(load).run(context.Background())
+					return writeLoadSummary(os.Stdout, summary, jsonOutput)
+				},
+			},
+			{
+				Name:      "inspect",
+				Usage:     "Print the fields of hex or binary encoded signed reports, e.g. of an upload or download",
+				ArgsUsage: "[FILE]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:        "json",
+						Usage:       "Write JSON instead of text",
+						Destination: &jsonOutput,
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					data, err := readReportInput(ctx.Args().First())
+					if err != nil {
+						return err
+					}
+					return writeInspection(os.Stdout, inspectReports(data), jsonOutput)
+				},
+			},
+			{
+				Name:      "verify",
+				Usage:     "Check hex or binary encoded signed reports like the server checks uploads",
+				ArgsUsage: "[FILE]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:        "json",
+						Usage:       "Write JSON instead of text",
+						Destination: &jsonOutput,
+					},
+					&cli.StringFlag{
+						Name:        "tenant",
+						Usage:       "Check with the settings of this tenant from --tenants",
+						Destination: &tenantID,
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					config, err := readConfig()
+					if err != nil {
+						return err
+					}
+					config, err = tenantConfig(config, tenantFile, tenantID)
+					if err != nil {
+						return err
+					}
+					data, err := readReportInput(ctx.Args().First())
+					if err != nil {
+						return err
+					}
+					result := verifyReports(data, config)
+					if err := writeVerification(os.Stdout, result, jsonOutput); err != nil {
+						return err
+					}
+					if result.Invalid > 0 || result.Error != "" {
+						return errors.New("Verification failed")
+					}
+					return nil
+				},
+			},
 		},
 		Action: func(ctx *cli.Context) error {
-			dbHost, dbName, dbUser, dbPassword := readPostgresSettings()
-			dbConnection, err := NewDBConnection(dbHost, dbUser, dbPassword, dbName)
+			config, err := readConfig()
+			if err != nil {
+				return err
+			}
+
+			dbConnection, err := connectDB()
+			if err != nil {
+				return err
+			}
+			if pgNotify {
+				if err := dbConnection.listenForReports(); err != nil {
+					return err
+				}
+			}
+			var tenants *tenants
+			if tenantFile != "" {
+				tenants, err = loadTenants(tenantFile, config)
+				if err != nil {
+					return err
+				}
+			}
+			router, err := GetRouter(port, dbConnection, config, tenants)
 			if err != nil {
 				return err
 			}
-			return GetRouter(port, dbConnection).Run(fmt.Sprintf(":%s", port))
+
+			var tlsConfig *tls.Config
+			if tlsCert != "" || tlsKey != "" {
+				if tlsCert == "" || tlsKey == "" {
+					return errors.New("Both --tls-cert and --tls-key are required for TLS")
+				}
+				tlsConfig, err = newTLSConfig(tlsCert, tlsKey, tlsClientCA)
+				if err != nil {
+					return err
+				}
+			} else if tlsClientCA != "" {
+				return errors.New("--tls-client-ca requires --tls-cert and --tls-key")
+			}
+
+			errs := make(chan error, 2)
+			if grpcPort != "" {
+				lis, err := net.Listen("tcp", fmt.Sprintf(":%s", grpcPort))
+				if err != nil {
+					return err
+				}
+				go func() {
+					errs <- NewGRPCServer(dbConnection, config, tenants, tlsConfig).Serve(lis)
+				}()
+			}
+
+			go func() {
+				if tlsConfig == nil {
+					errs <- router.Run(fmt.Sprintf(":%s", port))
+					return
+				}
+				server := &http.Server{
+					Addr:      fmt.Sprintf(":%s", port),
+					Handler:   router,
+					TLSConfig: tlsConfig,
+				}
+				errs <- server.ListenAndServeTLS("", "")
+			}()
+			return <-errs
 		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
 		fmt.Println(err.Error())
+		os.Exit(1)
 	}
 }
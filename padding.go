@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// decoyHeader marks uploads as decoys if set to "1". Clients should send
+	// it with every upload, set to "0" for real reports, so that real and
+	// decoy requests have the same size.
+	decoyHeader = "X-Ito-Decoy"
+	// paddingHeader contains the padding of padded responses.
+	paddingHeader = "X-Ito-Padding"
+
+	invalidDecoyError = "Invalid " + decoyHeader + " header, expected 0 or 1"
+)
+
+// isDecoy returns whether the request of c is a decoy upload.
+func isDecoy(c *gin.Context) (bool, error) {
+	switch c.GetHeader(decoyHeader) {
+	case "", "0":
+		return false, nil
+	case "1":
+		return true, nil
+	default:
+		return false, errors.New(invalidDecoyError)
+	}
+}
+
+// paddingWriter buffers the response body so that the padding can be added
+// as a header before the response is sent.
+type paddingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *paddingWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *paddingWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// padResponses returns a middleware that pads the responses of the following
+// handlers to a multiple of bucketSize bytes. The padding is sent in a header
+// so that the body stays unchanged. Only the body and the content type are
+// accounted for, as the other headers don't depend on the request.
+func padResponses(bucketSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if bucketSize <= 0 {
+			return
+		}
+
+		w := &paddingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		size := w.body.Len() + len(w.Header().Get("Content-Type"))
+		// Always add the header, even if size is a multiple of bucketSize.
+		w.Header().Set(paddingHeader, strings.Repeat("0", bucketSize-size%bucketSize))
+		if w.body.Len() == 0 {
+			w.WriteHeaderNow()
+			return
+		}
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+	}
+}
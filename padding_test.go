@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPadResponses(t *testing.T) {
+	const bucketSize = 64
+
+	r := gin.New()
+	r.GET("/empty", padResponses(bucketSize), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/error", padResponses(bucketSize), func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	})
+	r.GET("/large", padResponses(bucketSize), func(c *gin.Context) {
+		c.String(http.StatusOK, "%0100d", 0)
+	})
+
+	for _, tc := range []struct {
+		path string
+		code int
+		size int
+	}{
+		{"/empty", http.StatusOK, 0},
+		{"/error", http.StatusBadRequest, len(`{"error":"Invalid request"}`) + len(gin.MIMEJSON+"; charset=utf-8")},
+		{"/large", http.StatusOK, 100 + len(gin.MIMEPlain+"; charset=utf-8")},
+	} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tc.path, nil)
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, tc.code, rec.Code, tc.path)
+		padding := rec.Header().Get(paddingHeader)
+		assert.NotEmpty(t, padding, tc.path)
+		assert.Equal(t, 0, (tc.size+len(padding))%bucketSize, tc.path)
+		assert.Equal(t, tc.size, rec.Body.Len()+len(rec.Header().Get("Content-Type")), tc.path)
+	}
+}
+
+func TestIsDecoy(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		decoy  bool
+		valid  bool
+	}{
+		{"", false, true},
+		{"0", false, true},
+		{"1", true, true},
+		{"yes", false, false},
+	} {
+		rec := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(rec)
+		ctx.Request, _ = http.NewRequest("POST", "/tcnreport", nil)
+		ctx.Request.Header.Set(decoyHeader, tc.header)
+
+		decoy, err := isDecoy(ctx)
+		assert.Equal(t, tc.decoy, decoy, tc.header)
+		assert.Equal(t, tc.valid, err == nil, tc.header)
+	}
+}
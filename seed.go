@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"time"
+
+	"github.com/ito-org/go-backend/tcn"
+)
+
+const (
+	// seedMaxSpan is the maximum number of keys of a seeded report, i.e. one
+	// day of TCNs rotated every 15 minutes. It keeps fixture files small.
+	seedMaxSpan = 24 * 4
+	// seedMaxJ1 is the maximum j1 of a seeded report.
+	seedMaxJ1 = 14 * 24 * 4
+)
+
+// seedSettings configure the generation of development data.
+type seedSettings struct {
+	Count int
+	// Seed seeds the random number generator. The same settings always
+	// generate the same reports.
+	Seed int64
+	// The reports are received in [Start, End).
+	Start time.Time
+	End   time.Time
+	// MemoTypes are the memo types the reports are spread across.
+	MemoTypes []uint8
+	TenantID  string
+}
+
+// validate returns an error if the settings can't be used.
+func (s *seedSettings) validate() error {
+	if s.Count <= 0 {
+		return errors.New("--count must be positive")
+	}
+	if !s.Start.Before(s.End) {
+		return errors.New("--start must be before --end")
+	}
+	if len(s.MemoTypes) == 0 {
+		return errors.New("At least one memo type must be accepted")
+	}
+	return nil
+}
+
+// seedReport is a generated signed report together with the secrets a
+// client needs to match it. Keys and data are hex encoded.
+type seedReport struct {
+	// RAK is the report authorization key (the ed25519 private key) and RVK
+	// the report verification key of the report.
+	RAK        string    `json:"rak"`
+	RVK        string    `json:"rvk"`
+	J1         uint16    `json:"j1"`
+	J2         uint16    `json:"j2"`
+	MemoType   string    `json:"memo_type"`
+	MemoData   string    `json:"memo_data"`
+	ReceivedAt time.Time `json:"received_at"`
+	// TCNs are the temporary contact numbers covered by the report, i.e. the
+	// TCNs a device that was in contact observed.
+	TCNs []string `json:"tcns"`
+
+	signedReport *tcn.SignedReport
+}
+
+// seedFixture is the fixture file written by the seed subcommand.
+type seedFixture struct {
+	Seed    int64         `json:"seed"`
+	Tenant  string        `json:"tenant,omitempty"`
+	Reports []*seedReport `json:"reports"`
+}
+
+// generateSeed generates the reports described by s. The reports are
+// ordered by the time they are received.
+func generateSeed(s *seedSettings) (*seedFixture, error) {
+	rng := rand.New(rand.NewSource(s.Seed))
+	fixture := &seedFixture{
+		Seed:    s.Seed,
+		Tenant:  s.TenantID,
+		Reports: make([]*seedReport, 0, s.Count),
+	}
+
+	interval := s.End.Sub(s.Start) / time.Duration(s.Count)
+	for i := 0; i < s.Count; i++ {
+		memoType := s.MemoTypes[rng.Intn(len(s.MemoTypes))]
+		memoData, err := generateMemoData(rng, memoType)
+		if err != nil {
+			return nil, err
+		}
+
+		rak, err := tcn.NewReportAuthorizationKey(rng)
+		if err != nil {
+			return nil, err
+		}
+		j1 := uint16(1 + rng.Intn(seedMaxJ1))
+		j2 := j1 + uint16(1+rng.Intn(seedMaxSpan))
+		signedReport, err := rak.CreateSignedReport(j1, j2, &tcn.Memo{
+			Type: memoType,
+			Len:  uint8(len(memoData)),
+			Data: memoData,
+		})
+		if err != nil {
+			return nil, err
+		}
+		report := signedReport.Report
+		tcns, err := rak.TemporaryContactNumbers(j1, j2)
+		if err != nil {
+			return nil, err
+		}
+
+		jitter := time.Duration(0)
+		if interval > 0 {
+			jitter = time.Duration(rng.Int63n(int64(interval)))
+		}
+		// Postgres stores timestamps with microsecond precision.
+		receivedAt := s.Start.Add(time.Duration(i)*interval + jitter).Truncate(time.Microsecond).UTC()
+		r := &seedReport{
+			RAK:          hex.EncodeToString(rak.PrivateKey()),
+			RVK:          hex.EncodeToString(report.RVK),
+			J1:           j1,
+			J2:           j2,
+			MemoType:     fmt.Sprintf("0x%x", memoType),
+			MemoData:     hex.EncodeToString(memoData),
+			ReceivedAt:   receivedAt,
+			TCNs:         make([]string, len(tcns)),
+			signedReport: signedReport,
+		}
+		for j, n := range tcns {
+			r.TCNs[j] = hex.EncodeToString(n[:])
+		}
+		fixture.Reports = append(fixture.Reports, r)
+	}
+	return fixture, nil
+}
+
+// generateMemoData returns random memo data that's valid for memoType.
+func generateMemoData(rng *rand.Rand, memoType uint8) ([]byte, error) {
+	if memoType != tcn.ITOMemoCode {
+		data := make([]byte, rng.Intn(32))
+		rng.Read(data)
+		return data, nil
+	}
+
+	memo := &tcn.ITOMemo{
+		Version:  tcn.ITOMemoVersion,
+		Kind:     tcn.ITOReportSymptoms,
+		Symptoms: tcn.ITOSymptoms(1 + rng.Intn(int(tcn.ITOSymptomsAll))),
+	}
+	if rng.Intn(2) == 0 {
+		memo.Kind = tcn.ITOReportVerifiedTest
+		memo.VerificationToken = make([]byte, 16)
+		rng.Read(memo.VerificationToken)
+	}
+	return memo.Bytes()
+}
+
+// storeSeed stores the reports of fixture for its tenant.
+func (db *DBConnection) storeSeed(fixture *seedFixture) error {
+	for _, r := range fixture.Reports {
+		meta := reportMetadata{
+			ReceivedAt: r.ReceivedAt,
+			Origin:     originSeed,
+			TenantID:   fixture.Tenant,
+		}
+		if err := db.insertSignedReport(r.signedReport, meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSeedFixture writes fixture to path as JSON.
+func writeSeedFixture(path string, fixture *seedFixture) error {
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
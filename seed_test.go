@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSeedSettings() *seedSettings {
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	return &seedSettings{
+		Count:     20,
+		Seed:      42,
+		Start:     start,
+		End:       start.AddDate(0, 0, 14),
+		MemoTypes: []uint8{tcn.CoEpiMemoCode, tcn.ITOMemoCode},
+	}
+}
+
+func TestGenerateSeed(t *testing.T) {
+	settings := testSeedSettings()
+	assert.NoError(t, settings.validate())
+	fixture, err := generateSeed(settings)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, settings.Count, len(fixture.Reports))
+
+	config := DefaultConfig()
+	config.MemoTypes = settings.MemoTypes
+	memoTypes := map[string]int{}
+	var last time.Time
+	for _, r := range fixture.Reports {
+		assert.NoError(t, validateSignedReport(config, r.signedReport))
+		memoTypes[r.MemoType]++
+
+		assert.False(t, r.ReceivedAt.Before(settings.Start))
+		assert.True(t, r.ReceivedAt.Before(settings.End))
+		assert.False(t, r.ReceivedAt.Before(last))
+		last = r.ReceivedAt
+
+		assert.Equal(t, hex.EncodeToString(r.signedReport.Report.RVK), r.RVK)
+		assert.Equal(t, int(r.J2-r.J1), len(r.TCNs))
+	}
+	assert.Equal(t, 2, len(memoTypes))
+
+	// The same settings generate the same fixture, other seeds don't.
+	again, err := generateSeed(settings)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	a, _ := json.Marshal(fixture)
+	b, _ := json.Marshal(again)
+	assert.Equal(t, a, b)
+
+	settings.Seed++
+	other, err := generateSeed(settings)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.NotEqual(t, fixture.Reports[0].RAK, other.Reports[0].RAK)
+}
+
+func TestSeedFixtureMatches(t *testing.T) {
+	fixture, err := generateSeed(testSeedSettings())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// A client that observed one TCN of every report finds all reports.
+	observations := []tcn.Observation{}
+	signedReports := []*tcn.SignedReport{}
+	for _, r := range fixture.Reports {
+		b, err := hex.DecodeString(r.TCNs[len(r.TCNs)-1])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		o := tcn.Observation{ObservedAt: r.ReceivedAt}
+		copy(o.TCN[:], b)
+		observations = append(observations, o)
+		signedReports = append(signedReports, r.signedReport)
+	}
+	matches := tcn.NewMatcher(observations).Match(signedReports)
+	assert.Equal(t, len(fixture.Reports), len(matches))
+
+	// The fixture contains the keys that signed the reports.
+	for _, r := range fixture.Reports {
+		rak, err := hex.DecodeString(r.RAK)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		k, err := tcn.NewReportAuthorizationKeyFromSeed(ed25519.PrivateKey(rak).Seed())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		report, err := k.CreateReport(r.J1, r.J2, r.signedReport.Report.Memo)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, r.signedReport.Report, report)
+	}
+}
+
+func TestSeedSettingsValidate(t *testing.T) {
+	settings := testSeedSettings()
+	settings.Count = 0
+	assert.Error(t, settings.validate())
+
+	settings = testSeedSettings()
+	settings.End = settings.Start
+	assert.Error(t, settings.validate())
+
+	settings = testSeedSettings()
+	settings.MemoTypes = nil
+	assert.Error(t, settings.validate())
+}
+
+func TestStoreSeed(t *testing.T) {
+	settings := testSeedSettings()
+	settings.Count = 3
+	settings.TenantID = "seed-test"
+	settings.Seed = time.Now().UnixNano()
+	fixture, err := generateSeed(settings)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := handler.dbConn.storeSeed(fixture); err != nil {
+		t.Error(err)
+		return
+	}
+
+	signedReports, err := handler.dbConn.getSignedReports(&reportFilter{
+		TenantID: settings.TenantID,
+		Origins:  []reportOrigin{originSeed},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, r := range fixture.Reports {
+		found := false
+		for _, sr := range signedReports {
+			if hex.EncodeToString(sr.Report.RVK) == r.RVK {
+				found = true
+				assert.True(t, r.ReceivedAt.Equal(sr.Metadata.ReceivedAt))
+			}
+		}
+		assert.True(t, found)
+	}
+}
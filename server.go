@@ -1,121 +1,659 @@
 package main
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ito-org/go-backend/tcn"
 )
 
 const (
-	requestBodyReadError    = "Failed to read request body"
-	invalidRequestError     = "Invalid request"
-	reportVerificationError = "Failed to verify report"
+	// mimeBinary is the content type of the TCN wire format.
+	mimeBinary = "application/octet-stream"
+	// maxBatchSize is the maximum number of reports in a batch upload.
+	maxBatchSize = 1000
+	// maxJSONReportLength is an upper bound of the length of a signed report
+	// in JSON, where keys, signature and memo data are base64 encoded.
+	maxJSONReportLength = 4 * tcn.SignedReportMaxLength
+
+	requestBodyReadError     = "Failed to read request body"
+	invalidRequestError      = "Invalid request"
+	reportVerificationError  = "Failed to verify report"
+	invalidEncodingError     = "Invalid encoding"
+	invalidCursorError       = "Invalid cursor"
+	memoTypeNotAcceptedError = "Memo type not accepted"
+	trailingDataError        = "Request contains data after the signed report, use /tcnreport/batch to upload several reports"
+	batchTooLargeError       = "Too many reports in batch"
+	emptyBatchError          = "Batch contains no reports"
+	unknownRegionError       = "Unknown region"
+	invalidTimeError         = "Invalid time, expected RFC 3339 or unix seconds"
+	invalidLimitError        = "Invalid limit"
+	paginatedFromError       = "'from' can't be combined with 'after' or 'limit'"
+	verificationTokenError   = "Verification token not signed by a known issuer"
+
+	// nextCursorHeader is the response header containing the cursor of the
+	// next page of a paginated download.
+	nextCursorHeader = "X-Next-Cursor"
+	// signatureHeader is the response header containing the base64 encoded
+	// Ed25519 signature of a report download by the tenant's signing key.
+	signatureHeader = "X-Ito-Signature"
+
+	// originKey is the context key of the origin of uploaded reports.
+	originKey = "origin"
 )
 
-// GetRouter returns the Gin router.
-func GetRouter(port string, dbConnection *DBConnection) *gin.Engine {
+// GetRouter returns the Gin router. Requests are logged to stdout as
+// configured in config. If tenants isn't nil, every request must belong to
+// one of them, either through the route prefix /t/<tenant ID> or through the
+// hostname.
+func GetRouter(port string, dbConnection *DBConnection, config *Config, tenants *tenants) (*gin.Engine, error) {
 	h := &TCNReportHandler{
 		dbConn: dbConnection,
+		config: config,
+	}
+
+	logger, err := requestLogger(config, os.Stdout)
+	if err != nil {
+		return nil, err
 	}
 
-	r := gin.Default()
-	r.POST("/tcnreport", h.postTCNReport)
-	r.GET("/tcnreport", h.getTCNReport)
-	return r
+	r := gin.New()
+	r.Use(logger, recovery(), resolveTenant(tenants))
+	h.registerRoutes(&r.RouterGroup)
+	if tenants != nil {
+		h.registerRoutes(r.Group("/t/:tenant"))
+	}
+	return r, nil
+}
+
+// registerRoutes registers the API endpoints in g.
+func (h *TCNReportHandler) registerRoutes(g *gin.RouterGroup) {
+	// Responses to uploads are padded so that they don't reveal whether an
+	// upload was a decoy.
+	g.POST("/tcnreport", padResponses(h.config.PaddingBucketSize), h.postTCNReport)
+	g.POST("/tcnreport/batch", padResponses(h.config.PaddingBucketSize), h.postTCNReportBatch)
+	g.GET("/tcnreport", h.getTCNReport)
+	g.GET("/tcnreport/stream", h.streamTCNReports)
+	g.GET("/stats", h.getStats)
+
+	// Federation peers exchange reports over mutual TLS.
+	federation := g.Group("/federation", requireClientCert(), withOrigin(originFederation))
+	federation.POST("/tcnreport", h.postTCNReport)
+	federation.POST("/tcnreport/batch", h.postTCNReportBatch)
+	federation.GET("/tcnreport", h.getTCNReport)
+
+	admin := g.Group("/admin", requireClientCert())
+	admin.GET("/tcnreport", h.getAdminTCNReports)
 }
 
 // TCNReportHandler implements the handler functions for the API endpoints.
-// It also holds the database connection that's used by the handler functions.
+// It also holds the database connection and configuration that are used by
+// the handler functions. config is the configuration of the default tenant;
+// handlers use configFor to get the configuration of the request's tenant.
 type TCNReportHandler struct {
 	dbConn *DBConnection
+	config *Config
+}
+
+// withOrigin returns a middleware that marks reports uploaded through the
+// following handlers with origin.
+func withOrigin(origin reportOrigin) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(originKey, origin)
+	}
+}
+
+// uploadOrigin returns the origin set by withOrigin or originUpload.
+func uploadOrigin(c *gin.Context) reportOrigin {
+	if origin, ok := c.Get(originKey); ok {
+		return origin.(reportOrigin)
+	}
+	return originUpload
+}
+
+// uploadMetadata returns the metadata of the reports of an upload. The
+// region is given by the 'region' query param and may be empty.
+func uploadMetadata(c *gin.Context, config *Config) (reportMetadata, error) {
+	region := c.Query("region")
+	if region != "" && !config.acceptsRegion(region) {
+		return reportMetadata{}, errors.New(unknownRegionError)
+	}
+	return reportMetadata{
+		Origin:   uploadOrigin(c),
+		Region:   region,
+		TenantID: config.TenantID,
+	}, nil
+}
+
+// parseRegionFilter parses the regions given by the 'region' query params of
+// c. All regions must be configured.
+func parseRegionFilter(c *gin.Context, config *Config) ([]string, error) {
+	regions := parseRegions(c.QueryArray("region"))
+	for _, r := range regions {
+		if !config.acceptsRegion(r) {
+			return nil, errors.New(unknownRegionError)
+		}
+	}
+	return regions, nil
 }
 
 func (h *TCNReportHandler) postTCNReport(c *gin.Context) {
-	body := c.Request.Body
-	data, err := ioutil.ReadAll(body)
+	var signedReport *tcn.SignedReport
+
+	decoy, err := isDecoy(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	config := h.configFor(c)
+	meta, err := uploadMetadata(c, config)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if c.ContentType() == gin.MIMEJSON {
+		// Like in the wire format, the body must contain exactly one report.
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, maxJSONReportLength)
+		dec := json.NewDecoder(body)
+		signedReport = &tcn.SignedReport{}
+		if err := dec.Decode(signedReport); err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			respondError(c, http.StatusBadRequest, trailingDataError)
+			return
+		}
+	} else {
+		body := c.Request.Body
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, requestBodyReadError)
+			return
+		}
+
+		signedReport, err = tcn.GetSignedReport(data)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(data) > tcn.SignedReportMinLength+int(signedReport.Memo.Len) {
+			respondError(c, http.StatusBadRequest, trailingDataError)
+			return
+		}
+	}
+
+	if err := validateSignedReport(config, signedReport); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Decoys are processed like real reports up to the point where they'd be
+	// stored, so that both take the same time.
+	if decoy {
+		err = h.dbConn.insertDecoySignedReports([]*tcn.SignedReport{signedReport}, meta)
+	} else {
+		err = h.dbConn.insertSignedReport(signedReport, meta)
+	}
 	if err != nil {
-		c.String(http.StatusBadRequest, requestBodyReadError)
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	signedReport, err := tcn.GetSignedReport(data)
+	c.Status(http.StatusOK)
+}
+
+// batchResult is the result of a single report of a batch upload. Status is
+// the HTTP status code the report would have received if it had been
+// uploaded on its own.
+type batchResult struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// postTCNReportBatch accepts several signed reports at once, either
+// concatenated in the TCN wire format or as a JSON array. All valid reports
+// are stored in one transaction; the response lists a result for each
+// report in the order of the request.
+func (h *TCNReportHandler) postTCNReportBatch(c *gin.Context) {
+	var signedReports []*tcn.SignedReport
+
+	decoy, err := isDecoy(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	config := h.configFor(c)
+	meta, err := uploadMetadata(c, config)
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		respondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// If the memo field doesn't exist or the memo type is not ito's code, we
-	// simply ignore the request.
-	if signedReport.Report.Memo == nil || signedReport.Report.Memo.Type != 0x2 {
-		c.String(http.StatusBadRequest, invalidRequestError)
+	if c.ContentType() == gin.MIMEJSON {
+		// Like binary batches, JSON batches are decoded report by report, and
+		// the body is limited so that single reports can't be arbitrarily
+		// large either.
+		if c.Request.ContentLength > maxBatchSize*maxJSONReportLength {
+			respondError(c, http.StatusRequestEntityTooLarge, batchTooLargeError)
+			return
+		}
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchSize*maxJSONReportLength)
+		dec := json.NewDecoder(body)
+		if t, err := dec.Token(); err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		} else if t != json.Delim('[') {
+			respondError(c, http.StatusBadRequest, invalidRequestError)
+			return
+		}
+		for dec.More() {
+			if len(signedReports) == maxBatchSize {
+				respondError(c, http.StatusRequestEntityTooLarge, batchTooLargeError)
+				return
+			}
+			var sr *tcn.SignedReport
+			if err := dec.Decode(&sr); err != nil {
+				respondError(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			signedReports = append(signedReports, sr)
+		}
+		if _, err := dec.Token(); err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		// Decode the reports one by one so that oversized batches are
+		// rejected without reading the whole body.
+		dec := tcn.NewDecoder(c.Request.Body)
+		for {
+			sr := &tcn.SignedReport{}
+			err := dec.Decode(sr)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				respondError(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			if len(signedReports) == maxBatchSize {
+				respondError(c, http.StatusRequestEntityTooLarge, batchTooLargeError)
+				return
+			}
+			signedReports = append(signedReports, sr)
+		}
+	}
+
+	if len(signedReports) == 0 {
+		respondError(c, http.StatusBadRequest, emptyBatchError)
 		return
 	}
+	if len(signedReports) > maxBatchSize {
+		respondError(c, http.StatusRequestEntityTooLarge, batchTooLargeError)
+		return
+	}
+
+	// Check everything but the signatures first and then verify the
+	// signatures of the remaining reports concurrently.
+	results := make([]batchResult, len(signedReports))
+	checked := make([]*tcn.SignedReport, 0, len(signedReports))
+	checkedIdx := make([]int, 0, len(signedReports))
+	for i, sr := range signedReports {
+		if sr == nil {
+			results[i] = batchResult{Status: http.StatusBadRequest, Error: invalidRequestError}
+			continue
+		}
+		if err := validateReport(config, sr.Report); err != nil {
+			results[i] = batchResult{Status: http.StatusBadRequest, Error: err.Error()}
+			continue
+		}
+		results[i] = batchResult{Status: http.StatusOK}
+		checked = append(checked, sr)
+		checkedIdx = append(checkedIdx, i)
+	}
+
+	failed := tcn.VerifyBatch(checked, 0)
+	for _, i := range failed {
+		results[checkedIdx[i]] = batchResult{Status: http.StatusBadRequest, Error: reportVerificationError}
+	}
+
+	valid := make([]*tcn.SignedReport, 0, len(checked)-len(failed))
+	for i, sr := range checked {
+		if results[checkedIdx[i]].Status == http.StatusOK {
+			valid = append(valid, sr)
+		}
+	}
+
+	if len(valid) > 0 {
+		if decoy {
+			err = h.dbConn.insertDecoySignedReports(valid, meta)
+		} else {
+			err = h.dbConn.insertSignedReports(valid, meta)
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// validateSignedReport checks whether the server accepts signedReport. All
+// upload paths go through this function, independent of the wire format.
+func validateSignedReport(config *Config, signedReport *tcn.SignedReport) error {
+	if err := validateReport(config, signedReport.Report); err != nil {
+		return err
+	}
 
 	ok, err := signedReport.Verify()
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
-		return
+		return err
 	}
 
 	if !ok {
-		c.String(http.StatusBadRequest, reportVerificationError)
-		return
+		return errors.New(reportVerificationError)
+	}
+	return nil
+}
+
+// validateReport performs all checks of validateSignedReport except for the
+// signature verification.
+func validateReport(config *Config, report *tcn.Report) error {
+	// If the memo field doesn't exist, we simply ignore the request.
+	if report == nil || report.Memo == nil {
+		return errors.New(invalidRequestError)
+	}
+
+	if err := report.Validate(); err != nil {
+		return err
+	}
+	if err := report.ValidateSpan(config.MaxKeySpan); err != nil {
+		return err
+	}
+
+	if !config.acceptsMemoType(report.Memo.Type) {
+		return errors.New(memoTypeNotAcceptedError)
+	}
+	if err := tcn.ValidateMemo(report.Memo); err != nil {
+		return err
+	}
+	return validateVerificationToken(config, report)
+}
+
+// validateVerificationToken checks that the verification token of a verified
+// test report is the signature of the report's RVK by one of the tenant's
+// verification issuers. Tokens aren't checked if the tenant has no issuers.
+func validateVerificationToken(config *Config, report *tcn.Report) error {
+	if len(config.VerificationIssuers) == 0 || report.Memo.Type != tcn.ITOMemoCode {
+		return nil
+	}
+	memo, err := tcn.DecodeITOMemo(report.Memo.Data)
+	if err != nil {
+		return err
+	}
+	if memo.Kind != tcn.ITOReportVerifiedTest {
+		return nil
+	}
+	for _, issuer := range config.VerificationIssuers {
+		if ed25519.Verify(issuer, report.RVK, memo.VerificationToken) {
+			return nil
+		}
 	}
+	return errors.New(verificationTokenError)
+}
 
-	if err := h.dbConn.insertSignedReport(signedReport); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+// respondError writes msg as a JSON object if the request was made with JSON
+// and as plain text otherwise.
+func respondError(c *gin.Context, code int, msg string) {
+	if c.ContentType() == gin.MIMEJSON || c.NegotiateFormat(mimeBinary, gin.MIMEJSON) == gin.MIMEJSON {
+		c.JSON(code, gin.H{"error": msg})
 		return
 	}
+	c.String(code, msg)
+}
 
-	c.Status(http.StatusOK)
+// parseReportFilter returns the filter given by the query params of c. The
+// 'memotype' query param restricts the returned reports to the given memo
+// types, 'region' to the given regions and 'received_after' and
+// 'received_before' to the reports received in that time window. 'since'
+// restricts them to the reports stored since then, so that pollers also get
+// imported reports that were received earlier. It is clamped to the
+// retention window of config.
+func parseReportFilter(c *gin.Context, config *Config) (*reportFilter, error) {
+	filter := &reportFilter{TenantID: config.TenantID}
+	var err error
+	filter.MemoTypes, err = parseMemoTypes(c.QueryArray("memotype"))
+	if err != nil {
+		return nil, err
+	}
+	if filter.ReceivedAfter, err = parseTime(c.Query("received_after")); err != nil {
+		return nil, err
+	}
+	if filter.ReceivedBefore, err = parseTime(c.Query("received_before")); err != nil {
+		return nil, err
+	}
+	if filter.Regions, err = parseRegionFilter(c, config); err != nil {
+		return nil, err
+	}
+
+	since, err := parseTime(c.Query("since"))
+	if err != nil {
+		return nil, err
+	}
+	if !since.IsZero() {
+		if config.Retention > 0 {
+			if start := config.retentionStart(time.Now()); since.Before(start) {
+				since = start
+			}
+		}
+		filter.StoredAfter = since
+	}
+	return filter, nil
+}
+
+// parseTime parses an RFC 3339 timestamp or a unix timestamp in seconds. An
+// empty string results in the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.New(invalidTimeError)
+	}
+	return t, nil
+}
+
+// parsePage returns the page given by the query params of c. 'after' is the
+// cursor of the last report of the previous page and 'limit' the page size.
+// paginated is false if neither is given.
+func parsePage(c *gin.Context) (cursor uint64, limit int, paginated bool, err error) {
+	limit = defaultListLimit
+	if after := c.Query("after"); after != "" {
+		cursor, err = strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			return 0, 0, false, errors.New(invalidCursorError)
+		}
+		paginated = true
+	}
+	if l := c.Query("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			return 0, 0, false, errors.New(invalidLimitError)
+		}
+		if limit > maxListLimit {
+			limit = maxListLimit
+		}
+		paginated = true
+	}
+	return cursor, limit, paginated, nil
 }
 
 func (h *TCNReportHandler) getTCNReport(c *gin.Context) {
-	var signedReports []*tcn.SignedReport
-	var err error
+	var signedReports []*storedSignedReport
+
+	config := h.configFor(c)
+	filter, err := parseReportFilter(c, config)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	cursor, limit, paginated, err := parsePage(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// The 'from' query param is used to only get reports that were made after
 	// the one in 'from'.
 	from := c.Query("from")
 
-	if from == "" {
-		signedReports, err = h.dbConn.getSignedReports()
+	if from != "" && paginated {
+		respondError(c, http.StatusBadRequest, paginatedFromError)
+		return
+	}
+
+	if paginated {
+		signedReports, err = h.dbConn.getSignedReportsAfter(cursor, limit, filter)
+		if err == nil {
+			// Clients request the next page with 'after' set to this cursor.
+			nextCursor := cursor
+			if len(signedReports) > 0 {
+				nextCursor = signedReports[len(signedReports)-1].ID
+			}
+			c.Header(nextCursorHeader, strconv.FormatUint(nextCursor, 10))
+		}
+	} else if from == "" {
+		signedReports, err = h.dbConn.getSignedReports(filter)
 	} else {
 		fromBytes, err := hex.DecodeString(from)
 		if err != nil {
-			c.String(http.StatusBadRequest, err.Error())
+			respondError(c, http.StatusBadRequest, err.Error())
 			return
 		}
 
 		var report *tcn.Report
 		report, err = tcn.GetReport(fromBytes)
 		if err != nil {
-			c.String(http.StatusBadRequest, err.Error())
+			respondError(c, http.StatusBadRequest, err.Error())
 			return
 		}
-		signedReports, err = h.dbConn.getNewSignedReports(report)
+		signedReports, err = h.dbConn.getNewSignedReports(report, filter)
 		if err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
+			respondError(c, http.StatusInternalServerError, err.Error())
 			return
 		}
 	}
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	data := []byte{}
-	for _, sr := range signedReports {
-		b, err := sr.Bytes()
+	// The body is built in memory, so that it can be signed before it's
+	// sent.
+	var body bytes.Buffer
+	contentType := mimeBinary
+	if c.NegotiateFormat(mimeBinary, gin.MIMEJSON) == gin.MIMEJSON {
+		contentType = gin.MIMEJSON + "; charset=utf-8"
+		var data []byte
+		if data, err = json.Marshal(signedReports); err == nil {
+			body.Write(data)
+		}
+	} else {
+		enc := tcn.NewEncoder(&body)
+		for _, sr := range signedReports {
+			if err = enc.Encode(sr.SignedReport); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Printf("Failed to encode signed reports: %s\n", err.Error())
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if config.SigningKey != nil {
+		sig := ed25519.Sign(config.SigningKey, body.Bytes())
+		c.Header(signatureHeader, base64.StdEncoding.EncodeToString(sig))
+	}
+	c.Data(http.StatusOK, contentType, body.Bytes())
+}
+
+// streamTCNReports sends every newly stored signed report as a Server-Sent
+// Event, starting with the reports stored after the stream was opened. The
+// event ID is the report's cursor, so clients resume after the last received
+// report by sending it in the Last-Event-ID header. The
+// 'encoding' query param selects hex (default) or base64 event data. The
+// stream can be filtered like getTCNReport.
+func (h *TCNReportHandler) streamTCNReports(c *gin.Context) {
+	var encode func([]byte) string
+	switch c.DefaultQuery("encoding", "hex") {
+	case "hex":
+		encode = hex.EncodeToString
+	case "base64":
+		encode = base64.StdEncoding.EncodeToString
+	default:
+		respondError(c, http.StatusBadRequest, invalidEncodingError)
+		return
+	}
+
+	filter, err := parseReportFilter(c, h.configFor(c))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cursor := uint64(latestCursor)
+	if lastEventID := c.GetHeader("Last-Event-ID"); lastEventID != "" {
+		var err error
+		cursor, err = strconv.ParseUint(lastEventID, 10, 64)
 		if err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
+			respondError(c, http.StatusBadRequest, invalidCursorError)
 			return
 		}
-		data = append(data, b...)
 	}
 
-	c.Data(http.StatusOK, "application/octet-stream", data)
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	err = h.dbConn.followSignedReports(c.Request.Context(), cursor, filter, func(sr *storedSignedReport) error {
+		if sr == nil {
+			_, err := io.WriteString(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+			return err
+		}
+
+		b, err := sr.Bytes()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: report\ndata: %s\n\n", sr.ID, encode(b))
+		c.Writer.Flush()
+		return err
+	})
+	if err != nil {
+		fmt.Printf("Report stream ended: %s\n", err.Error())
+	}
 }
@@ -3,22 +3,43 @@ package main
 import (
 	"bytes"
 	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ito-org/go-backend/tcn"
+	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 )
 
 var handler *TCNReportHandler
 
+// testMemoData is a valid ito memo that's used for the reports in the tests.
+var testMemoData = func() []byte {
+	data, err := (&tcn.ITOMemo{
+		Version:  tcn.ITOMemoVersion,
+		Kind:     tcn.ITOReportSymptoms,
+		Symptoms: tcn.ITOSymptomFever | tcn.ITOSymptomCough,
+	}).Bytes()
+	if err != nil {
+		panic(err.Error())
+	}
+	return data
+}()
+
 // Init function before every test
 func TestMain(m *testing.M) {
 	// Initialize the database connection and the handler structure so we can
@@ -28,13 +49,21 @@ func TestMain(m *testing.M) {
 
 	dbHost, dbName, dbUser, dbPassword := readPostgresSettings()
 
-	dbConn, err := NewDBConnection(dbHost, dbUser, dbPassword, dbName)
+	dbConn, err := NewDBConnection(dbHost, dbUser, dbPassword, dbName, readPostgresTLSSettings())
 	if err != nil {
 		panic(err.Error())
 	}
 
+	// The reports are generated from fixed seeds and duplicates are rejected,
+	// so every run starts with empty tables. Stored statistics of earlier runs
+	// would use up the privacy budget of the stats tests as well.
+	if _, err := dbConn.Exec(`TRUNCATE SignedReport, Report, Memo, DailyStats RESTART IDENTITY;`); err != nil {
+		panic(err.Error())
+	}
+
 	handler = &TCNReportHandler{
 		dbConn: dbConn,
+		config: DefaultConfig(),
 	}
 	code := m.Run()
 	os.Exit(code)
@@ -62,23 +91,8 @@ func getPostRequest(data []byte) (*httptest.ResponseRecorder, *http.Request) {
 }
 
 func TestPostTCNReport(t *testing.T) {
-	_, rak, report, err := tcn.GenerateReport(0, 1, []byte("symptom data"))
-	if err != nil {
-		t.Error(err)
-		return
-	}
-
-	signedReport, err := tcn.GenerateSignedReport(rak, report)
-	if err != nil {
-		t.Error(err)
-		return
-	}
-
-	b, err := signedReport.Bytes()
-	if err != nil {
-		t.Error(err)
-		return
-	}
+	signedReport := generateSignedReport(t)
+	b := signedReportBytes(t, signedReport)
 
 	rec, req := getPostRequest(b)
 	ctx, _ := gin.CreateTestContext(rec)
@@ -91,14 +105,14 @@ func TestPostTCNReport(t *testing.T) {
 func TestPostTCNReportInvalidSig(t *testing.T) {
 	// Store just the report here since we're going to sign it with a different
 	// key
-	_, _, report, err := tcn.GenerateReport(0, 1, nil)
+	_, _, report, err := tcn.GenerateReport(1, 2, testMemoData)
 	if err != nil {
 		t.Error(err)
 	}
 
 	// Generate second private key to sign with so we can force an error to
 	// happen
-	_, rak2, _, err := tcn.GenerateReport(0, 1, nil)
+	_, rak2, _, err := tcn.GenerateReport(1, 2, testMemoData)
 	if err != nil {
 		t.Error(err)
 		return
@@ -138,7 +152,7 @@ func TestPostTCNReportInvalidSig(t *testing.T) {
 }
 
 func TestPostTCNInvalidType(t *testing.T) {
-	_, rak, report, err := tcn.GenerateReport(0, 1, nil)
+	_, rak, report, err := tcn.GenerateReport(1, 2, nil)
 	if err != nil {
 		t.Error(err)
 		return
@@ -153,12 +167,31 @@ func TestPostTCNInvalidType(t *testing.T) {
 		return
 	}
 
-	b, err := signedReport.Bytes()
+	b := signedReportBytes(t, signedReport)
+
+	rec, req := getPostRequest(b)
+	ctx, _ := gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.postTCNReport(ctx)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestPostTCNInvalidMemo(t *testing.T) {
+	_, rak, report, err := tcn.GenerateReport(1, 2, []byte("symptom data"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	signedReport, err := tcn.GenerateSignedReport(rak, report)
 	if err != nil {
 		t.Error(err)
 		return
 	}
 
+	b := signedReportBytes(t, signedReport)
+
 	rec, req := getPostRequest(b)
 	ctx, _ := gin.CreateTestContext(rec)
 	ctx.Request = req
@@ -168,7 +201,7 @@ func TestPostTCNInvalidType(t *testing.T) {
 }
 
 func TestPostTCNInvalidLength(t *testing.T) {
-	_, rak, report, err := tcn.GenerateReport(0, 1, nil)
+	_, rak, report, err := tcn.GenerateReport(1, 2, nil)
 	if err != nil {
 		t.Error(err)
 		return
@@ -211,21 +244,11 @@ func TestPostTCNInvalidLength(t *testing.T) {
 func TestGetTCNReports(t *testing.T) {
 	signedReports := [5]*tcn.SignedReport{}
 	for i := 0; i < 5; i++ {
-		_, rak, report, _ := tcn.GenerateReport(0, 1, []byte("symptom data"))
-		signedReport, err := tcn.GenerateSignedReport(rak, report)
-		if err != nil {
-			t.Error(err.Error())
-			return
-		}
-
-		signedReportBytes, err := signedReport.Bytes()
-		if err != nil {
-			t.Error(err.Error())
-			return
-		}
+		signedReport := generateSignedReport(t)
+		b := signedReportBytes(t, signedReport)
 
 		// POST reports
-		rec, req := getPostRequest(signedReportBytes)
+		rec, req := getPostRequest(b)
 		ctx, _ := gin.CreateTestContext(rec)
 		ctx.Request = req
 		handler.postTCNReport(ctx)
@@ -251,7 +274,7 @@ func TestGetTCNReports(t *testing.T) {
 	}
 
 	// Retrieve the signed reports from the handler function's response
-	retSignedReports := tcn.GetSignedReports(body)
+	retSignedReports, err := tcn.GetSignedReports(body)
 	if err != nil {
 		t.Error(err.Error())
 		return
@@ -279,23 +302,13 @@ func postSignedReports(signedReportBytes []byte) {
 func TestGetNewTCNReports(t *testing.T) {
 	signedReports := [5]*tcn.SignedReport{}
 	for i := 0; i < 5; i++ {
-		_, rak, report, _ := tcn.GenerateReport(0, 1, []byte("symptom data"))
-		signedReport, err := tcn.GenerateSignedReport(rak, report)
-		if err != nil {
-			t.Error(err.Error())
-			return
-		}
-
-		signedReportBytes, err := signedReport.Bytes()
-		if err != nil {
-			t.Error(err.Error())
-			return
-		}
+		signedReport := generateSignedReport(t)
+		b := signedReportBytes(t, signedReport)
 
-		postSignedReports(signedReportBytes)
+		postSignedReports(b)
 		if i == 2 {
 			// Post it twice
-			postSignedReports(signedReportBytes)
+			postSignedReports(b)
 		}
 		signedReports[i] = signedReport
 	}
@@ -326,7 +339,7 @@ func TestGetNewTCNReports(t *testing.T) {
 	}
 
 	// Retrieve the signed reports from the handler function's response
-	retSignedReports := tcn.GetSignedReports(body)
+	retSignedReports, err := tcn.GetSignedReports(body)
 	if err != nil {
 		t.Error(err.Error())
 		return
@@ -343,3 +356,1067 @@ func TestGetNewTCNReports(t *testing.T) {
 
 	assert.Equal(t, len(signedReports[2:]), found)
 }
+
+func TestTCNReportJSON(t *testing.T) {
+	signedReport := generateSignedReport(t)
+
+	b, err := json.Marshal(signedReport)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rec, req := getPostRequest(b)
+	req.Header.Set("Content-Type", "application/json")
+	ctx, _ := gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.postTCNReport(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec, req = getGetRequest()
+	req.Header.Set("Accept", "application/json")
+	ctx, _ = gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.getTCNReport(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	retSignedReports := []*tcn.SignedReport{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &retSignedReports); err != nil {
+		t.Error(err)
+		return
+	}
+
+	found := 0
+	for _, rr := range retSignedReports {
+		if reflect.DeepEqual(signedReport, rr) {
+			found++
+		}
+	}
+	assert.Equal(t, 1, found)
+}
+
+func TestPostTCNReportJSONInvalidSig(t *testing.T) {
+	_, _, report, err := tcn.GenerateReport(1, 2, testMemoData)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, rak2, _, err := tcn.GenerateReport(1, 2, testMemoData)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fakeSignedReport, err := tcn.GenerateSignedReport(rak2, report)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	b, err := json.Marshal(fakeSignedReport)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rec, req := getPostRequest(b)
+	req.Header.Set("Content-Type", "application/json")
+	ctx, _ := gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.postTCNReport(ctx)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error":"`+reportVerificationError+`"}`, rec.Body.String())
+}
+
+func TestGetTCNReportsMemoTypeFilter(t *testing.T) {
+	config := DefaultConfig()
+	config.MemoTypes = []uint8{tcn.CoEpiMemoCode, tcn.ITOMemoCode}
+	h := &TCNReportHandler{
+		dbConn: handler.dbConn,
+		config: config,
+	}
+
+	_, rak, report, _ := tcn.GenerateReport(1, 2, testMemoData)
+	report.Memo.Type = tcn.CoEpiMemoCode
+	coEpiReport, err := tcn.GenerateSignedReport(rak, report)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	b := signedReportBytes(t, coEpiReport)
+
+	rec, req := getPostRequest(b)
+	ctx, _ := gin.CreateTestContext(rec)
+	ctx.Request = req
+	h.postTCNReport(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	for _, tc := range []struct {
+		query     string
+		memoTypes []uint8
+		found     int
+	}{
+		{"0", []uint8{tcn.CoEpiMemoCode}, 1},
+		{"0x2", []uint8{tcn.ITOMemoCode}, 0},
+		{"2,0", []uint8{tcn.CoEpiMemoCode, tcn.ITOMemoCode}, 1},
+	} {
+		rec, req = getGetRequest()
+		req.URL.RawQuery = "memotype=" + tc.query
+		ctx, _ = gin.CreateTestContext(rec)
+		ctx.Request = req
+		h.getTCNReport(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		retSignedReports, err := tcn.GetSignedReports(rec.Body.Bytes())
+		assert.NoError(t, err)
+
+		found := 0
+		for _, rr := range retSignedReports {
+			assert.Contains(t, tc.memoTypes, rr.Memo.Type)
+			if reflect.DeepEqual(coEpiReport, rr) {
+				found++
+			}
+		}
+		assert.Equal(t, tc.found, found, tc.query)
+	}
+
+	rec, req = getGetRequest()
+	req.URL.RawQuery = "memotype=0xfe"
+	ctx, _ = gin.CreateTestContext(rec)
+	ctx.Request = req
+	h.getTCNReport(ctx)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func getBatchPostRequest(data []byte) (*httptest.ResponseRecorder, *http.Request) {
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/tcnreport/batch", bytes.NewReader(data))
+	return rec, req
+}
+
+func TestPostTCNReportBatch(t *testing.T) {
+	// Reports 0 and 2 are valid, report 1 is signed with a different key
+	_, _, invalidReport, _ := tcn.GenerateReport(1, 2, testMemoData)
+	signedReports := [3]*tcn.SignedReport{}
+	data := []byte{}
+	for i := range signedReports {
+		_, rak, report, _ := tcn.GenerateReport(1, 2, testMemoData)
+		if i == 1 {
+			report = invalidReport
+		}
+		signedReport, err := tcn.GenerateSignedReport(rak, report)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		b := signedReportBytes(t, signedReport)
+		data = append(data, b...)
+		signedReports[i] = signedReport
+	}
+
+	rec, req := getBatchPostRequest(data)
+	ctx, _ := gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.postTCNReportBatch(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	resp := struct {
+		Results []batchResult `json:"results"`
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, []batchResult{
+		{Status: http.StatusOK},
+		{Status: http.StatusBadRequest, Error: reportVerificationError},
+		{Status: http.StatusOK},
+	}, resp.Results)
+
+	rec, req = getGetRequest()
+	ctx, _ = gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.getTCNReport(ctx)
+	retSignedReports, err := tcn.GetSignedReports(rec.Body.Bytes())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	found := make([]int, len(signedReports))
+	for i, r := range signedReports {
+		for _, rr := range retSignedReports {
+			if reflect.DeepEqual(r, rr) {
+				found[i]++
+			}
+		}
+	}
+	assert.Equal(t, []int{1, 0, 1}, found)
+
+	// Truncated batches are rejected as a whole
+	rec, req = getBatchPostRequest(data[:len(data)-1])
+	ctx, _ = gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.postTCNReportBatch(ctx)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// The same batch as JSON
+	b, err := json.Marshal(signedReports)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rec, req = getBatchPostRequest(b)
+	req.Header.Set("Content-Type", gin.MIMEJSON)
+	ctx, _ = gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.postTCNReportBatch(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, []batchResult{
+		{Status: http.StatusOK},
+		{Status: http.StatusBadRequest, Error: reportVerificationError},
+		{Status: http.StatusOK},
+	}, resp.Results)
+}
+
+func TestPostTCNReportBatchJSONLimits(t *testing.T) {
+	h := &TCNReportHandler{config: DefaultConfig()}
+	post := func(body []byte, contentLength int64) int {
+		rec, req := getBatchPostRequest(body)
+		req.Header.Set("Content-Type", gin.MIMEJSON)
+		req.ContentLength = contentLength
+		ctx, _ := gin.CreateTestContext(rec)
+		ctx.Request = req
+		h.postTCNReportBatch(ctx)
+		return rec.Code
+	}
+
+	signedReport := generateSignedReport(t)
+	signedReports := make([]*tcn.SignedReport, maxBatchSize+1)
+	for i := range signedReports {
+		signedReports[i] = signedReport
+	}
+	b, err := json.Marshal(signedReports)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.True(t, len(b) < maxBatchSize*maxJSONReportLength)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(b, int64(len(b))))
+
+	// Bodies above the limit are rejected, whether their length is known
+	// or not.
+	b = append([]byte("["+strings.Repeat(" ", maxBatchSize*maxJSONReportLength)), b[1:]...)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(b, int64(len(b))))
+	assert.Equal(t, http.StatusBadRequest, post(b, -1))
+
+	assert.Equal(t, http.StatusBadRequest, post([]byte(`{"report": null}`), -1))
+	assert.Equal(t, http.StatusBadRequest, post([]byte(`[]`), -1))
+}
+
+func TestPostTCNReportTrailingData(t *testing.T) {
+	signedReport := generateSignedReport(t)
+	b := signedReportBytes(t, signedReport)
+
+	rec, req := getPostRequest(append(b, b...))
+	ctx, _ := gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.postTCNReport(ctx)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, trailingDataError, rec.Body.String())
+}
+
+func TestPostTCNReportJSONLimits(t *testing.T) {
+	h := &TCNReportHandler{config: DefaultConfig()}
+	post := func(body []byte) *httptest.ResponseRecorder {
+		rec, req := getPostRequest(body)
+		req.Header.Set("Content-Type", gin.MIMEJSON)
+		ctx, _ := gin.CreateTestContext(rec)
+		ctx.Request = req
+		h.postTCNReport(ctx)
+		return rec
+	}
+
+	b, err := json.Marshal(generateSignedReport(t))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, body := range [][]byte{
+		append(append([]byte{}, b...), b...),
+		append(append([]byte{}, b...), []byte(" x")...),
+	} {
+		rec := post(body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"error":"`+trailingDataError+`"}`, rec.Body.String())
+	}
+
+	rec := post(append([]byte(strings.Repeat(" ", maxJSONReportLength)), b...))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestPostTCNReportKeyRange(t *testing.T) {
+	for _, tc := range []struct {
+		j1, j2 uint16
+		code   int
+		msg    string
+	}{
+		{0, 1, http.StatusBadRequest, tcn.ErrJ1Zero.Error()},
+		{5, 4, http.StatusBadRequest, tcn.ErrInvalidKeyRange.Error()},
+		{1, defaultMaxKeySpan + 2, http.StatusBadRequest, tcn.ErrKeySpanTooLarge.Error()},
+		// Key indices above 255 have to be stored correctly
+		{1000, 1000 + defaultMaxKeySpan, http.StatusOK, ""},
+	} {
+		b := signedReportBytes(t, generateSignedReportRange(t, tc.j1, tc.j2))
+
+		rec, req := getPostRequest(b)
+		ctx, _ := gin.CreateTestContext(rec)
+		ctx.Request = req
+		handler.postTCNReport(ctx)
+		assert.Equal(t, tc.code, rec.Code, "j1=%d j2=%d", tc.j1, tc.j2)
+		if tc.msg != "" {
+			assert.Equal(t, tc.msg, rec.Body.String())
+		}
+	}
+}
+
+func TestReportMetadata(t *testing.T) {
+	signedReport := generateSignedReport(t)
+	b := signedReportBytes(t, signedReport)
+
+	// Allow for some clock skew between the test and the database.
+	start := time.Now().Add(-time.Minute)
+
+	rec, req := getPostRequest(b)
+	ctx, _ := gin.CreateTestContext(rec)
+	ctx.Request = req
+	withOrigin(originFederation)(ctx)
+	handler.postTCNReport(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	type adminSignedReport struct {
+		tcn.SignedReport
+		reportMetadata
+	}
+	getAdminReports := func(query string) []*adminSignedReport {
+		rec, req := getGetRequest()
+		req.URL.RawQuery = query
+		ctx, _ := gin.CreateTestContext(rec)
+		ctx.Request = req
+		handler.getAdminTCNReports(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var resp struct {
+			SignedReports []json.RawMessage `json:"signed_reports"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Error(err)
+			return nil
+		}
+		ret := []*adminSignedReport{}
+		for _, raw := range resp.SignedReports {
+			r := &adminSignedReport{}
+			if err := json.Unmarshal(raw, &r.SignedReport); err != nil {
+				t.Error(err)
+				return nil
+			}
+			if err := json.Unmarshal(raw, &r.reportMetadata); err != nil {
+				t.Error(err)
+				return nil
+			}
+			ret = append(ret, r)
+		}
+		return ret
+	}
+
+	window := url.Values{
+		"origin":         {"federation"},
+		"received_after": {start.Format(time.RFC3339)},
+		"limit":          {"1000"},
+	}
+	found := 0
+	for _, r := range getAdminReports(window.Encode()) {
+		assert.Equal(t, originFederation, r.Origin)
+		if reflect.DeepEqual(signedReport, &r.SignedReport) {
+			assert.Equal(t, verificationSignature, r.Verification)
+			assert.True(t, r.ReceivedAt.After(start))
+			found++
+		}
+	}
+	assert.Equal(t, 1, found)
+
+	window.Set("received_before", start.Format(time.RFC3339))
+	for _, r := range getAdminReports(window.Encode()) {
+		assert.False(t, reflect.DeepEqual(signedReport, &r.SignedReport))
+	}
+
+	rec, req = getGetRequest()
+	req.URL.RawQuery = "origin=unknown"
+	ctx, _ = gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.getAdminTCNReports(ctx)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestParseReportFilterSince(t *testing.T) {
+	config := DefaultConfig()
+	now := time.Now()
+
+	getFilter := func(query string) (*reportFilter, error) {
+		rec, req := getGetRequest()
+		req.URL.RawQuery = query
+		ctx, _ := gin.CreateTestContext(rec)
+		ctx.Request = req
+		return parseReportFilter(ctx, config)
+	}
+
+	since := now.Add(-time.Hour).Truncate(time.Second)
+	filter, err := getFilter("since=" + since.Format(time.RFC3339))
+	assert.NoError(t, err)
+	assert.True(t, since.Equal(filter.StoredAfter))
+	assert.True(t, filter.ReceivedAfter.IsZero())
+
+	filter, err = getFilter(fmt.Sprintf("since=%d", since.Unix()))
+	assert.NoError(t, err)
+	assert.True(t, since.Equal(filter.StoredAfter))
+
+	// Timestamps before the retention window are clamped.
+	filter, err = getFilter("since=0")
+	assert.NoError(t, err)
+	assert.False(t, filter.StoredAfter.Before(config.retentionStart(now)))
+
+	// 'since' applies to the store time and 'received_after' to the receive
+	// time.
+	filter, err = getFilter(fmt.Sprintf("since=%d&received_after=%s", since.Unix(), now.Format(time.RFC3339)))
+	assert.NoError(t, err)
+	assert.True(t, since.Equal(filter.StoredAfter))
+	assert.True(t, now.Truncate(time.Second).Equal(filter.ReceivedAfter))
+
+	_, err = getFilter("since=yesterday")
+	assert.EqualError(t, err, invalidTimeError)
+}
+
+func TestGetTCNReportSince(t *testing.T) {
+	start := time.Now().Add(-time.Minute)
+
+	signedReports := []*tcn.SignedReport{}
+	for i := 0; i < 3; i++ {
+		signedReport := generateSignedReport(t)
+		if err := handler.dbConn.insertSignedReport(signedReport, reportMetadata{Origin: originUpload}); err != nil {
+			t.Error(err)
+			return
+		}
+		signedReports = append(signedReports, signedReport)
+	}
+
+	// Page through all reports received since start, one report at a time.
+	received := []*tcn.SignedReport{}
+	cursor := "0"
+	for {
+		rec, req := getGetRequest()
+		req.URL.RawQuery = url.Values{
+			"since":    {fmt.Sprint(start.Unix())},
+			"memotype": {"0x2"},
+			"after":    {cursor},
+			"limit":    {"1"},
+		}.Encode()
+		ctx, _ := gin.CreateTestContext(rec)
+		ctx.Request = req
+		handler.getTCNReport(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		page, err := tcn.GetSignedReports(rec.Body.Bytes())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.LessOrEqual(t, len(page), 1)
+		if len(page) == 0 {
+			assert.Equal(t, cursor, rec.Header().Get(nextCursorHeader))
+			break
+		}
+		received = append(received, page...)
+		cursor = rec.Header().Get(nextCursorHeader)
+	}
+
+	found := 0
+	for _, sr := range signedReports {
+		for _, rr := range received {
+			if reflect.DeepEqual(sr, rr) {
+				found++
+			}
+		}
+	}
+	assert.Equal(t, len(signedReports), found)
+
+	rec, req := getGetRequest()
+	req.URL.RawQuery = "from=00&after=1"
+	ctx, _ := gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.getTCNReport(ctx)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// storeInterleaved stores two signed reports in concurrent transactions. The
+// second transaction is started after the first one has stored its report,
+// but before it's committed. during is called while both are in flight.
+func storeInterleaved(t *testing.T, signedReports []*tcn.SignedReport, meta reportMetadata, during func()) {
+	t.Helper()
+	inserted := make(chan struct{})
+	commit := make(chan struct{})
+	errs := make(chan error, 2)
+	go func() {
+		_, err := handler.dbConn.storeReports(func(tx *sqlx.Tx) ([]*storedSignedReport, error) {
+			sr, err := insertSignedReport(tx, signedReports[0], meta)
+			close(inserted)
+			<-commit
+			if err != nil {
+				return nil, err
+			}
+			return []*storedSignedReport{sr}, nil
+		})
+		errs <- err
+	}()
+	select {
+	case <-inserted:
+	case err := <-errs:
+		t.Fatal(err)
+	}
+
+	go func() {
+		errs <- handler.dbConn.insertSignedReport(signedReports[1], meta)
+	}()
+	// Give the second transaction time to store its report.
+	time.Sleep(100 * time.Millisecond)
+	during()
+
+	close(commit)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetSignedReportsAfterConcurrentCommits(t *testing.T) {
+	cursor, err := handler.dbConn.getLatestSignedReportID()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	signedReports := generateSignedReports(t, 2)
+	meta := reportMetadata{Origin: originUpload, TenantID: "commit-order-test"}
+	filter := &reportFilter{TenantID: meta.TenantID}
+
+	// The report of the second transaction must not be returned before the
+	// first one was committed, or the cursor would move past the first
+	// report.
+	storeInterleaved(t, signedReports, meta, func() {
+		srs, err := handler.dbConn.getSignedReportsAfter(cursor, maxListLimit, filter)
+		assert.NoError(t, err)
+		assert.Empty(t, srs)
+	})
+
+	srs, err := handler.dbConn.getSignedReportsAfter(cursor, maxListLimit, filter)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if assert.Equal(t, 2, len(srs)) {
+		assert.Equal(t, signedReports[0], srs[0].SignedReport)
+		assert.Equal(t, signedReports[1], srs[1].SignedReport)
+	}
+}
+
+func TestPostTCNReportDecoy(t *testing.T) {
+	signedReport := generateSignedReport(t)
+	b := signedReportBytes(t, signedReport)
+
+	// Decoys don't use up IDs.
+	var lastID, lastIDAfter uint64
+	if err := handler.dbConn.QueryRow("SELECT last_value FROM signedreport_id_seq").Scan(&lastID); err != nil {
+		t.Error(err)
+		return
+	}
+	defer func() {
+		if err := handler.dbConn.QueryRow("SELECT last_value FROM signedreport_id_seq").Scan(&lastIDAfter); err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, lastID, lastIDAfter)
+	}()
+
+	rec, req := getPostRequest(b)
+	req.Header.Set(decoyHeader, "1")
+	ctx, _ := gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.postTCNReport(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Decoys are validated like real reports.
+	invalid := append([]byte{}, b...)
+	invalid[len(invalid)-1] ^= 0xff
+	rec, req = getPostRequest(invalid)
+	req.Header.Set(decoyHeader, "1")
+	ctx, _ = gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.postTCNReport(ctx)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec, req = getBatchPostRequest(b)
+	req.Header.Set(decoyHeader, "1")
+	ctx, _ = gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.postTCNReportBatch(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec, req = getGetRequest()
+	ctx, _ = gin.CreateTestContext(rec)
+	ctx.Request = req
+	handler.getTCNReport(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	retSignedReports, err := tcn.GetSignedReports(rec.Body.Bytes())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, rr := range retSignedReports {
+		assert.False(t, reflect.DeepEqual(signedReport, rr))
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	getStats := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/stats?"+query, nil)
+		ctx, _ := gin.CreateTestContext(rec)
+		ctx.Request = req
+		handler.getStats(ctx)
+		return rec
+	}
+
+	rec := getStats("days=3")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var resp struct {
+		Days []*dailyStats `json:"days"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, resp.Days, 3)
+	assert.Equal(t, time.Now().UTC().AddDate(0, 0, -1).Format(statsDateFormat), resp.Days[2].Date)
+
+	// The noise is drawn once per day, repeated requests return the same
+	// values.
+	rec2 := getStats("days=3")
+	assert.Equal(t, http.StatusOK, rec2.Code)
+	assert.JSONEq(t, rec.Body.String(), rec2.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, getStats("days=0").Code)
+}
+
+func TestTCNReportRegions(t *testing.T) {
+	config := DefaultConfig()
+	config.Regions = []string{"by", "bw"}
+	h := &TCNReportHandler{
+		dbConn: handler.dbConn,
+		config: config,
+	}
+
+	regionReports := map[string]*tcn.SignedReport{}
+	for _, region := range []string{"by", "bw"} {
+		signedReport := generateSignedReport(t)
+		b := signedReportBytes(t, signedReport)
+
+		// Upload one report on its own and one in a batch.
+		rec, req := getPostRequest(b)
+		ctx, _ := gin.CreateTestContext(rec)
+		req.URL.RawQuery = "region=" + region
+		ctx.Request = req
+		if region == "by" {
+			h.postTCNReport(ctx)
+		} else {
+			h.postTCNReportBatch(ctx)
+		}
+		assert.Equal(t, http.StatusOK, rec.Code)
+		regionReports[region] = signedReport
+	}
+
+	rec, req := getPostRequest([]byte{})
+	req.URL.RawQuery = "region=be"
+	ctx, _ := gin.CreateTestContext(rec)
+	ctx.Request = req
+	h.postTCNReport(ctx)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, unknownRegionError, rec.Body.String())
+
+	for _, tc := range []struct {
+		query    string
+		expected []string
+	}{
+		{"region=by", []string{"by"}},
+		{"region=bw", []string{"bw"}},
+		{"region=by,bw", []string{"by", "bw"}},
+		{"region=by&region=bw", []string{"by", "bw"}},
+	} {
+		rec, req := getGetRequest()
+		req.URL.RawQuery = tc.query
+		ctx, _ := gin.CreateTestContext(rec)
+		ctx.Request = req
+		h.getTCNReport(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		retSignedReports, err := tcn.GetSignedReports(rec.Body.Bytes())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for region, sr := range regionReports {
+			found := false
+			for _, rr := range retSignedReports {
+				if reflect.DeepEqual(sr, rr) {
+					found = true
+				}
+			}
+			assert.Equal(t, contains(tc.expected, region), found, tc.query)
+		}
+	}
+
+	rec, req = getGetRequest()
+	req.URL.RawQuery = "region=be"
+	ctx, _ = gin.CreateTestContext(rec)
+	ctx.Request = req
+	h.getTCNReport(ctx)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/stats?days=1&region=by", nil)
+	ctx, _ = gin.CreateTestContext(rec)
+	ctx.Request = req
+	h.getStats(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTenantIsolation(t *testing.T) {
+	tenantIDs := []string{"", "tenant-a", "tenant-b"}
+	tenantReports := map[string]*tcn.SignedReport{}
+	for _, tenantID := range tenantIDs {
+		signedReport := generateSignedReport(t)
+		meta := reportMetadata{Origin: originUpload, TenantID: tenantID}
+		if err := handler.dbConn.insertSignedReport(signedReport, meta); err != nil {
+			t.Error(err)
+			return
+		}
+		tenantReports[tenantID] = signedReport
+	}
+
+	// assertTenant checks that srs contain the report of tenantID and no
+	// report of another tenant.
+	assertTenant := func(tenantID string, srs []*storedSignedReport, expectOwn bool) {
+		found := false
+		for _, sr := range srs {
+			assert.Equal(t, tenantID, sr.Metadata.TenantID)
+			for otherID, other := range tenantReports {
+				if reflect.DeepEqual(other, sr.SignedReport) {
+					assert.Equal(t, tenantID, otherID)
+					found = true
+				}
+			}
+		}
+		assert.Equal(t, expectOwn, found, tenantID)
+	}
+
+	for _, tenantID := range tenantIDs {
+		filter := &reportFilter{TenantID: tenantID}
+
+		srs, err := handler.dbConn.getSignedReports(filter)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assertTenant(tenantID, srs, true)
+
+		srs, err = handler.dbConn.getSignedReportsAfter(0, maxListLimit, filter)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, sr := range srs {
+			assert.Equal(t, tenantID, sr.Metadata.TenantID)
+		}
+
+		// A report of another tenant can't be used to list reports.
+		for otherID, other := range tenantReports {
+			srs, err := handler.dbConn.getNewSignedReports(other.Report, filter)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if otherID != tenantID {
+				assert.Empty(t, srs)
+			} else {
+				assertTenant(tenantID, srs, false)
+			}
+		}
+	}
+
+	// The same holds for the HTTP API, where tenants are selected by the
+	// route prefix.
+	tenants, err := newTenants([]*tenantSettings{{ID: "tenant-a"}, {ID: "tenant-b"}}, DefaultConfig())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	router, err := GetRouter("8080", handler.dbConn, DefaultConfig(), tenants)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	b, err := tenantReports["tenant-b"].Bytes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/t/tenant-a/tcnreport?from="+hex.EncodeToString(b), nil)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Body.Bytes())
+
+	for _, tenantID := range []string{"tenant-a", "tenant-b"} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/t/"+tenantID+"/tcnreport", nil)
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		retSignedReports, err := tcn.GetSignedReports(rec.Body.Bytes())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for otherID, other := range tenantReports {
+			found := false
+			for _, sr := range retSignedReports {
+				if reflect.DeepEqual(other, sr) {
+					found = true
+				}
+			}
+			assert.Equal(t, otherID == tenantID, found, tenantID)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/t/tenant-c/tcnreport", nil)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+// verifiedTestMemo returns an ito memo of a verified test with token.
+func verifiedTestMemo(t *testing.T, token []byte) *tcn.Memo {
+	data, err := (&tcn.ITOMemo{
+		Version:           tcn.ITOMemoVersion,
+		Kind:              tcn.ITOReportVerifiedTest,
+		VerificationToken: token,
+	}).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	memo, err := tcn.GenerateMemo(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return memo
+}
+
+func TestValidateVerificationToken(t *testing.T) {
+	issuerPub, issuerPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, otherPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	config := DefaultConfig()
+	config.VerificationIssuers = []ed25519.PublicKey{issuerPub}
+
+	_, _, report, err := tcn.GenerateReport(1, 2, testMemoData)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, _, otherReport, err := tcn.GenerateReport(1, 2, testMemoData)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Symptom reports don't need a token.
+	assert.NoError(t, validateReport(config, report))
+
+	for _, tc := range []struct {
+		token []byte
+		err   bool
+	}{
+		{ed25519.Sign(issuerPriv, report.RVK), false},
+		{ed25519.Sign(otherPriv, report.RVK), true},
+		{ed25519.Sign(issuerPriv, otherReport.RVK), true},
+		{[]byte("token"), true},
+	} {
+		report.Memo = verifiedTestMemo(t, tc.token)
+		err := validateReport(config, report)
+		if tc.err {
+			assert.EqualError(t, err, verificationTokenError)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+
+	// Without issuers, any token is accepted.
+	assert.NoError(t, validateReport(DefaultConfig(), report))
+}
+
+func TestGetTCNReportSigned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signing-key")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Every tenant signs with its own key.
+	settings := []*tenantSettings{}
+	public := map[string]ed25519.PublicKey{}
+	for _, id := range []string{"signing-test-a", "signing-test-b"} {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		path := filepath.Join(dir, id)
+		seed := base64.StdEncoding.EncodeToString(priv.Seed())
+		if err := ioutil.WriteFile(path, []byte(seed), 0600); err != nil {
+			t.Error(err)
+			return
+		}
+		settings = append(settings, &tenantSettings{ID: id, SigningKey: path})
+		public[id] = pub
+	}
+	tenants, err := newTenants(settings, DefaultConfig())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	router, err := GetRouter("8080", handler.dbConn, DefaultConfig(), tenants)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	meta := reportMetadata{Origin: originUpload, TenantID: "signing-test-a"}
+	if err := handler.dbConn.insertSignedReport(generateSignedReport(t), meta); err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, accept := range []string{mimeBinary, gin.MIMEJSON} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/t/signing-test-a/tcnreport", nil)
+		req.Header.Set("Accept", accept)
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotEmpty(t, rec.Body.Bytes())
+
+		sig, err := base64.StdEncoding.DecodeString(rec.Header().Get(signatureHeader))
+		assert.NoError(t, err)
+		assert.True(t, ed25519.Verify(public["signing-test-a"], rec.Body.Bytes(), sig), accept)
+		assert.False(t, ed25519.Verify(public["signing-test-b"], rec.Body.Bytes(), sig), accept)
+	}
+
+	// Downloads aren't signed without a signing key.
+	plainRouter, err := GetRouter("8080", handler.dbConn, DefaultConfig(), nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/tcnreport", nil)
+	plainRouter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(signatureHeader))
+}
+
+func TestInsertSignedReportDuplicate(t *testing.T) {
+	signedReports := generateSignedReports(t, 2)
+	meta := reportMetadata{Origin: originUpload, TenantID: "duplicate-test"}
+
+	// Duplicates within a batch and of stored reports are skipped.
+	batch := []*tcn.SignedReport{signedReports[0], signedReports[0], signedReports[1]}
+	for i := 0; i < 2; i++ {
+		if err := handler.dbConn.insertSignedReports(batch, meta); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	n, err := handler.dbConn.importSignedReports([]*importedReport{
+		{SignedReport: signedReports[0]},
+		{SignedReport: signedReports[1]},
+	}, meta)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	for _, sr := range signedReports {
+		var count int
+		err := handler.dbConn.Get(&count, `
+			SELECT COUNT(*)
+			FROM SignedReport sr
+			JOIN Report r ON sr.report_id = r.id
+			JOIN Memo m ON r.memo_id = m.id
+			WHERE sr.tenant_id = $1 AND sr.sig = $2
+		`, meta.TenantID, sr.Sig)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
+
+		exists, err := signedReportExists(handler.dbConn, sr, meta.TenantID)
+		assert.NoError(t, err)
+		assert.True(t, exists)
+	}
+
+	// The rows inserted for the duplicates were removed again.
+	var orphans int
+	err = handler.dbConn.Get(&orphans, `
+		SELECT COUNT(*)
+		FROM Report r
+		WHERE r.tenant_id = $1
+		AND NOT EXISTS (SELECT 1 FROM SignedReport sr WHERE sr.report_id = r.id)
+	`, meta.TenantID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, orphans)
+
+	// Other tenants can store the same report.
+	other := meta
+	other.TenantID = "duplicate-test-other"
+	exists, err := signedReportExists(handler.dbConn, signedReports[0], other.TenantID)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	assert.NoError(t, handler.dbConn.insertSignedReport(signedReports[0], other))
+}
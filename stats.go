@@ -0,0 +1,388 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ito-org/go-backend/tcn"
+)
+
+const (
+	// defaultStatsEpsilon is the default privacy budget per day.
+	defaultStatsEpsilon = 1.0
+	// defaultStatsDays is the number of days returned by /stats by default.
+	defaultStatsDays = 14
+	// maxStatsDays is the maximum number of days returned by /stats.
+	maxStatsDays = 366
+
+	invalidDaysError   = "Invalid number of days"
+	dayIncompleteError = "Statistics are only available for past days"
+	budgetSpentError   = "The privacy budget of the day was spent on the statistics of all regions"
+
+	statsDateFormat = "2006-01-02"
+)
+
+// dailyStats are the differentially private statistics of the reports
+// received on one day (UTC).
+//
+// Every report is counted once in MemoTypes and at most once in every
+// symptom count, and only on the day it was received. Each day therefore
+// spends the privacy budget epsilon on its own: half of it on the memo type
+// counts (L1 sensitivity 1) and half on the symptom counts (L1 sensitivity
+// of the number of symptoms). Reports is the sum of the noisy memo type
+// counts. The noisy values are stored when they are computed first, so
+// repeated requests don't allow averaging out the noise.
+//
+// With regions, a report is counted in the statistics of all regions and in
+// those of its own region. The budget of the day is split between both (see
+// statsEpsilon and getDailyStats), and Epsilon is the part spent on these
+// statistics.
+type dailyStats struct {
+	Date      string           `json:"date"`
+	Region    string           `json:"region,omitempty"`
+	Epsilon   float64          `json:"epsilon"`
+	Reports   int64            `json:"reports"`
+	MemoTypes map[string]int64 `json:"memo_types"`
+	Symptoms  map[string]int64 `json:"symptoms"`
+}
+
+// memoTypeKey returns the key of memo type t in dailyStats.MemoTypes.
+func memoTypeKey(t uint8) string {
+	return fmt.Sprintf("%#x", t)
+}
+
+// statsSymptoms are the symptoms counted in dailyStats.Symptoms.
+var statsSymptoms = tcn.ITOSymptomsAll.Names()
+
+// laplaceNoise returns a sample of the Laplace distribution with mean 0 and
+// the given scale.
+func laplaceNoise(scale float64) (float64, error) {
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, err
+		}
+		// u is uniformly distributed in [-0.5, 0.5).
+		u := float64(binary.LittleEndian.Uint64(b[:])>>11)/(1<<53) - 0.5
+		if u == -0.5 {
+			continue
+		}
+		if u < 0 {
+			return scale * math.Log(1+2*u), nil
+		}
+		return -scale * math.Log(1-2*u), nil
+	}
+}
+
+// noisyCount returns count with Laplace noise of the given scale, rounded
+// and clamped to non-negative values.
+func noisyCount(count int64, scale float64) (int64, error) {
+	noise, err := laplaceNoise(scale)
+	if err != nil {
+		return 0, err
+	}
+	noisy := int64(math.Round(float64(count) + noise))
+	if noisy < 0 {
+		noisy = 0
+	}
+	return noisy, nil
+}
+
+// statsEpsilon returns the privacy budget spent on the statistics of all
+// regions of a day. With regions, half of the budget is left for the
+// statistics of the regions. Regions are disjoint, so the statistics of
+// different regions don't add up, but every report is also counted in the
+// statistics of all regions.
+func statsEpsilon(config *Config) float64 {
+	if len(config.Regions) > 0 {
+		return config.StatsEpsilon / 2
+	}
+	return config.StatsEpsilon
+}
+
+// newDailyStats adds noise for the privacy budget epsilon to the exact counts
+// of day. memoTypes are the exact report counts per memo type and symptoms
+// the exact report counts per symptom.
+func newDailyStats(day time.Time, region string, epsilon float64, config *Config, memoTypes map[uint8]int64, symptoms map[string]int64) (*dailyStats, error) {
+	stats := &dailyStats{
+		Date:      day.Format(statsDateFormat),
+		Region:    region,
+		Epsilon:   epsilon,
+		MemoTypes: map[string]int64{},
+		Symptoms:  map[string]int64{},
+	}
+
+	memoTypeScale := 1 / (stats.Epsilon / 2)
+	for _, mt := range config.MemoTypes {
+		count, err := noisyCount(memoTypes[mt], memoTypeScale)
+		if err != nil {
+			return nil, err
+		}
+		stats.MemoTypes[memoTypeKey(mt)] = count
+		stats.Reports += count
+	}
+
+	symptomScale := float64(len(statsSymptoms)) / (stats.Epsilon / 2)
+	for _, s := range statsSymptoms {
+		count, err := noisyCount(symptoms[s], symptomScale)
+		if err != nil {
+			return nil, err
+		}
+		stats.Symptoms[s] = count
+	}
+	return stats, nil
+}
+
+// countReports returns the exact report counts per memo type and per ito
+// symptom of the reports of tenantID received in [start, end). If region
+// isn't empty, only the reports of that region are counted.
+func (db *DBConnection) countReports(start, end time.Time, tenantID, region string) (map[uint8]int64, map[string]int64, error) {
+	filter := &reportFilter{
+		TenantID:       tenantID,
+		ReceivedAfter:  start,
+		ReceivedBefore: end,
+	}
+	if region != "" {
+		filter.Regions = []string{region}
+	}
+	conds, args := filter.conditions(nil)
+	rows, err := db.Queryx(
+		`
+		SELECT m.mtype, m.mdata
+		FROM SignedReport sr
+		JOIN Report r ON sr.report_id = r.id
+		JOIN Memo m ON r.memo_id = m.id
+		WHERE TRUE`+conds+`;
+		`,
+		args...,
+	)
+	if err != nil {
+		fmt.Printf("Failed to count reports: %s\n", err.Error())
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	memoTypes := map[uint8]int64{}
+	symptoms := map[string]int64{}
+	for rows.Next() {
+		var memoType uint8
+		var memoData []byte
+		if err := rows.Scan(&memoType, &memoData); err != nil {
+			fmt.Printf("Failed to scan memo: %s\n", err.Error())
+			return nil, nil, err
+		}
+		memoTypes[memoType]++
+
+		if memoType != tcn.ITOMemoCode {
+			continue
+		}
+		memo, err := tcn.DecodeITOMemo(memoData)
+		if err != nil {
+			// Reports are validated on upload, so this only happens for
+			// reports stored by earlier versions.
+			continue
+		}
+		for _, s := range memo.Symptoms.Names() {
+			symptoms[s]++
+		}
+	}
+	return memoTypes, symptoms, rows.Err()
+}
+
+// errBudgetSpent is returned by getDailyStats for the statistics of a region
+// on a day whose budget was spent on the statistics of all regions.
+var errBudgetSpent = errors.New(budgetSpentError)
+
+// getDailyStats returns the statistics of day, which must have ended
+// already, for region or for all regions if it's empty. The statistics are
+// kept per tenant of config. They are computed and stored on the first
+// request.
+//
+// The statistics of a region get the part of the day's budget that wasn't
+// spent on the stored statistics of all regions. That is all of it if they
+// were released before regions were configured, in which case
+// errBudgetSpent is returned.
+func (db *DBConnection) getDailyStats(day time.Time, region string, config *Config) (*dailyStats, error) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+	if end.After(time.Now()) {
+		return nil, errors.New(dayIncompleteError)
+	}
+
+	stats, err := db.getStoredDailyStats(start, config.TenantID, region)
+	if err != sql.ErrNoRows {
+		return stats, err
+	}
+
+	epsilon := statsEpsilon(config)
+	if region != "" {
+		global, err := db.getDailyStats(start, "", config)
+		if err != nil {
+			return nil, err
+		}
+		epsilon = config.StatsEpsilon - global.Epsilon
+		if epsilon <= 0 {
+			return nil, errBudgetSpent
+		}
+	}
+
+	memoTypes, symptoms, err := db.countReports(start, end, config.TenantID, region)
+	if err != nil {
+		return nil, err
+	}
+	stats, err = newDailyStats(start, region, epsilon, config, memoTypes, symptoms)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return nil, err
+	}
+	// Another replica may have stored the statistics in the meantime, in
+	// which case its values are returned.
+	if _, err := db.Exec(
+		`
+		INSERT INTO
+		DailyStats(tenant_id, day, region, stats)
+		VALUES($1, $2, $3, $4)
+		ON CONFLICT (tenant_id, day, region) DO NOTHING;
+		`,
+		config.TenantID,
+		start,
+		region,
+		string(data),
+	); err != nil {
+		fmt.Printf("Failed to insert statistics into database: %s\n", err.Error())
+		return nil, err
+	}
+	return db.getStoredDailyStats(start, config.TenantID, region)
+}
+
+// getStoredDailyStats returns the stored statistics of the tenant, day and
+// region or sql.ErrNoRows.
+func (db *DBConnection) getStoredDailyStats(day time.Time, tenantID, region string) (*dailyStats, error) {
+	var data []byte
+	if err := db.QueryRowx(
+		`
+		SELECT stats
+		FROM DailyStats
+		WHERE tenant_id = $1 AND day = $2 AND region = $3;
+		`,
+		tenantID,
+		day,
+		region,
+	).Scan(&data); err != nil {
+		if err != sql.ErrNoRows {
+			fmt.Printf("Failed to get statistics from database: %s\n", err.Error())
+		}
+		return nil, err
+	}
+
+	stats := &dailyStats{}
+	if err := json.Unmarshal(data, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// getLastDailyStats returns the statistics of region of the given number of
+// days before today, oldest first. Days without budget left for the
+// statistics of region are left out.
+func (db *DBConnection) getLastDailyStats(days int, region string, config *Config) ([]*dailyStats, error) {
+	today := time.Now().UTC()
+	stats := make([]*dailyStats, 0, days)
+	for i := days; i > 0; i-- {
+		s, err := db.getDailyStats(today.AddDate(0, 0, -i), region, config)
+		if err == errBudgetSpent {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+// parseStatsDays parses the number of days of statistics to return.
+func parseStatsDays(s string) (int, error) {
+	if s == "" {
+		return defaultStatsDays, nil
+	}
+	days, err := strconv.Atoi(s)
+	if err != nil || days <= 0 || days > maxStatsDays {
+		return 0, errors.New(invalidDaysError)
+	}
+	return days, nil
+}
+
+// getStats returns the differentially private statistics of the last days.
+// The 'days' query param sets the number of days and 'region' restricts the
+// statistics to a region.
+func (h *TCNReportHandler) getStats(c *gin.Context) {
+	days, err := parseStatsDays(c.Query("days"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	config := h.configFor(c)
+	region := c.Query("region")
+	if region != "" && !config.acceptsRegion(region) {
+		respondError(c, http.StatusBadRequest, unknownRegionError)
+		return
+	}
+
+	stats, err := h.dbConn.getLastDailyStats(days, region, config)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"days": stats})
+}
+
+// writeStatsCSV writes stats as CSV with one row per day. The columns are the
+// date, the region, epsilon, the number of reports, the memo types of config
+// and the symptoms.
+func writeStatsCSV(w io.Writer, stats []*dailyStats, config *Config) error {
+	header := []string{"date", "region", "epsilon", "reports"}
+	for _, mt := range config.MemoTypes {
+		header = append(header, "memo_type_"+memoTypeKey(mt))
+	}
+	header = append(header, statsSymptoms...)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, s := range stats {
+		record := []string{
+			s.Date,
+			s.Region,
+			strconv.FormatFloat(s.Epsilon, 'g', -1, 64),
+			strconv.FormatInt(s.Reports, 10),
+		}
+		for _, mt := range config.MemoTypes {
+			record = append(record, strconv.FormatInt(s.MemoTypes[memoTypeKey(mt)], 10))
+		}
+		for _, symptom := range statsSymptoms {
+			record = append(record, strconv.FormatInt(s.Symptoms[symptom], 10))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLaplaceNoise(t *testing.T) {
+	const n = 100000
+	const scale = 2.0
+
+	var sum, absSum float64
+	for i := 0; i < n; i++ {
+		noise, err := laplaceNoise(scale)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		sum += noise
+		absSum += math.Abs(noise)
+	}
+
+	// The mean of the distribution is 0 and the mean absolute deviation is
+	// the scale.
+	assert.InDelta(t, 0, sum/n, 0.05)
+	assert.InDelta(t, scale, absSum/n, 0.05)
+}
+
+func TestNewDailyStats(t *testing.T) {
+	config := DefaultConfig()
+	config.MemoTypes = []uint8{0x0, 0x2}
+	day := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	stats, err := newDailyStats(day, "", statsEpsilon(config), config, map[uint8]int64{0x2: 1000, 0x1: 10}, map[string]int64{"fever": 500})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	assert.Equal(t, "2020-05-01", stats.Date)
+	assert.Equal(t, config.StatsEpsilon, stats.Epsilon)
+
+	// With regions, half of the budget is left for the statistics of the
+	// report's region.
+	config.Regions = []string{"by", "bw"}
+	assert.Equal(t, config.StatsEpsilon/2, statsEpsilon(config))
+	// Only accepted memo types are published, including those without
+	// reports.
+	assert.Len(t, stats.MemoTypes, 2)
+	assert.Contains(t, stats.MemoTypes, "0x0")
+	assert.InDelta(t, 1000, stats.MemoTypes["0x2"], 100)
+	assert.Equal(t, stats.MemoTypes["0x0"]+stats.MemoTypes["0x2"], stats.Reports)
+
+	assert.Len(t, stats.Symptoms, len(statsSymptoms))
+	assert.InDelta(t, 500, stats.Symptoms["fever"], 500)
+	for _, count := range stats.Symptoms {
+		assert.GreaterOrEqual(t, count, int64(0))
+	}
+}
+
+func TestWriteStatsCSV(t *testing.T) {
+	config := DefaultConfig()
+	stats := []*dailyStats{
+		{
+			Date:      "2020-05-01",
+			Region:    "by",
+			Epsilon:   0.5,
+			Reports:   12,
+			MemoTypes: map[string]int64{"0x2": 12},
+			Symptoms:  map[string]int64{"fever": 3},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeStatsCSV(&buf, stats, config); err != nil {
+		t.Error(err)
+		return
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, records, 2)
+	assert.Equal(t, []string{"date", "region", "epsilon", "reports", "memo_type_0x2", "fever"}, records[0][:6])
+	assert.Equal(t, []string{"2020-05-01", "by", "0.5", "12", "12", "3"}, records[1][:6])
+	assert.Len(t, records[1], 5+len(statsSymptoms))
+}
+
+func TestParseStatsDays(t *testing.T) {
+	days, err := parseStatsDays("")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultStatsDays, days)
+
+	days, err = parseStatsDays("7")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, days)
+
+	for _, s := range []string{"0", "-1", "1000", "week"} {
+		_, err = parseStatsDays(s)
+		assert.EqualError(t, err, invalidDaysError, s)
+	}
+}
+
+func TestGetDailyStatsRegionBudget(t *testing.T) {
+	day := time.Now().UTC().AddDate(0, 0, -2)
+
+	// The statistics of all regions of the day were released before regions
+	// were configured, so there's no budget left for region statistics.
+	config := DefaultConfig()
+	config.TenantID = "stats-budget-test"
+	global, err := handler.dbConn.getDailyStats(day, "", config)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, config.StatsEpsilon, global.Epsilon)
+
+	config.Regions = []string{"by", "bw"}
+	_, err = handler.dbConn.getDailyStats(day, "by", config)
+	assert.Equal(t, errBudgetSpent, err)
+	stats, err := handler.dbConn.getLastDailyStats(3, "by", config)
+	assert.NoError(t, err)
+	for _, s := range stats {
+		assert.NotEqual(t, global.Date, s.Date)
+	}
+
+	// With regions, both get half of the budget.
+	config.TenantID = "stats-region-budget-test"
+	global, err = handler.dbConn.getDailyStats(day, "", config)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	regionStats, err := handler.dbConn.getDailyStats(day, "by", config)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, config.StatsEpsilon/2, global.Epsilon)
+	assert.Equal(t, config.StatsEpsilon/2, regionStats.Epsilon)
+}
@@ -0,0 +1,110 @@
+//go:build go1.18
+// +build go1.18
+
+package tcn_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/ito-org/go-backend/tcn"
+)
+
+// addSignedReportSeeds adds valid signed reports to the seed corpus of f.
+func addSignedReportSeeds(f *testing.F) {
+	for _, memoData := range [][]byte{nil, []byte("symptom data"), bytes.Repeat([]byte{0xff}, 255)} {
+		_, rak, report, err := tcn.GenerateReport(1, 8, memoData)
+		if err != nil {
+			f.Fatal(err)
+		}
+		signedReport, err := tcn.GenerateSignedReport(rak, report)
+		if err != nil {
+			f.Fatal(err)
+		}
+		b, err := signedReport.Bytes()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Add([]byte{})
+	f.Add(make([]byte, tcn.ReportMinLength))
+}
+
+func FuzzGetReport(f *testing.F) {
+	addSignedReportSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		report, err := tcn.GetReport(data)
+		if err != nil {
+			return
+		}
+		b, err := report.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data[:len(b)]) {
+			t.Fatalf("Round trip mismatch: %x != %x", b, data[:len(b)])
+		}
+	})
+}
+
+func FuzzGetSignedReport(f *testing.F) {
+	addSignedReportSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		signedReport, err := tcn.GetSignedReport(data)
+		if err != nil {
+			return
+		}
+		b, err := signedReport.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data[:len(b)]) {
+			t.Fatalf("Round trip mismatch: %x != %x", b, data[:len(b)])
+		}
+		// Verification must not panic on arbitrary keys and signatures.
+		if _, err := signedReport.Verify(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func FuzzGetSignedReports(f *testing.F) {
+	addSignedReportSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		signedReports, err := tcn.GetSignedReports(data)
+
+		// The decoder must accept exactly the same input.
+		dec := tcn.NewDecoder(bytes.NewReader(data))
+		var decoded []*tcn.SignedReport
+		var decErr error
+		for {
+			sr := &tcn.SignedReport{}
+			if decErr = dec.Decode(sr); decErr != nil {
+				break
+			}
+			decoded = append(decoded, sr)
+		}
+		if (err == nil) != (decErr == io.EOF) {
+			t.Fatalf("GetSignedReports and Decoder disagree: %v, %v", err, decErr)
+		}
+		if err != nil {
+			return
+		}
+		if len(decoded) != len(signedReports) {
+			t.Fatalf("Decoder returned %d reports, expected %d", len(decoded), len(signedReports))
+		}
+
+		b := []byte{}
+		for _, sr := range signedReports {
+			b, err = sr.AppendBytes(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(b, data) {
+			t.Fatalf("Round trip mismatch: %x != %x", b, data)
+		}
+	})
+}
@@ -0,0 +1,213 @@
+package tcn
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// ITOMemoVersion is the version of the ito memo schema implemented by
+	// this package.
+	ITOMemoVersion = 0x1
+	// ITOMemoHeaderLength is the length of an encoded ito memo without the
+	// verification token.
+	ITOMemoHeaderLength = 9
+	// ITOMemoMaxTokenLength is the maximum length of the verification token
+	// reference.
+	ITOMemoMaxTokenLength = 64
+)
+
+// ITOReportKind tells what an ito report is based on.
+type ITOReportKind uint8
+
+const (
+	// ITOReportVerifiedTest marks a report based on a positive test that was
+	// verified by a health authority.
+	ITOReportVerifiedTest ITOReportKind = 0x1
+	// ITOReportSymptoms marks a report based on self-reported symptoms.
+	ITOReportSymptoms ITOReportKind = 0x2
+)
+
+// ITOSymptoms is a bitfield of symptoms.
+type ITOSymptoms uint32
+
+// Symptoms that can be contained in an ito memo.
+const (
+	ITOSymptomFever ITOSymptoms = 1 << iota
+	ITOSymptomCough
+	ITOSymptomShortnessOfBreath
+	ITOSymptomFatigue
+	ITOSymptomMusclePain
+	ITOSymptomHeadache
+	ITOSymptomSoreThroat
+	ITOSymptomLossOfSmellOrTaste
+	ITOSymptomDiarrhea
+
+	// ITOSymptomsAll contains all known symptoms.
+	ITOSymptomsAll = ITOSymptomDiarrhea<<1 - 1
+)
+
+var itoSymptomNames = []string{
+	"fever",
+	"cough",
+	"shortness_of_breath",
+	"fatigue",
+	"muscle_pain",
+	"headache",
+	"sore_throat",
+	"loss_of_smell_or_taste",
+	"diarrhea",
+}
+
+// ITOMemo is the content of a memo of type ITOMemoCode.
+//
+// It's encoded as follows (multi-byte fields are little endian):
+//
+//	version (1) | kind (1) | onset bucket (2) | symptoms (4) |
+//	token length (1) | token (token length)
+type ITOMemo struct {
+	Version uint8         `json:"version"`
+	Kind    ITOReportKind `json:"kind"`
+	// OnsetBucket is the day of the symptom onset or the test, counted in
+	// days since the Unix epoch. 0 means unknown.
+	OnsetBucket uint16      `json:"onset_bucket"`
+	Symptoms    ITOSymptoms `json:"symptoms"`
+	// VerificationToken references the verification of a test result. It's
+	// required for verified test reports.
+	VerificationToken []byte `json:"verification_token,omitempty"`
+}
+
+// decodeITOMemoData and validateITOMemoData implement the ito memo type.
+func decodeITOMemoData(data []byte) (interface{}, error) {
+	return DecodeITOMemo(data)
+}
+
+func validateITOMemoData(data []byte) error {
+	_, err := DecodeITOMemo(data)
+	return err
+}
+
+// OnsetBucketFromTime returns the onset bucket of t.
+func OnsetBucketFromTime(t time.Time) uint16 {
+	return uint16(t.Unix() / (24 * 60 * 60))
+}
+
+// Onset returns the beginning of the onset bucket. It returns the zero time
+// if the onset is unknown.
+func (m *ITOMemo) Onset() time.Time {
+	if m.OnsetBucket == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(m.OnsetBucket)*24*60*60, 0).UTC()
+}
+
+// Validate checks that m conforms to the schema.
+func (m *ITOMemo) Validate() error {
+	if m.Version != ITOMemoVersion {
+		return fmt.Errorf("Unsupported ito memo version %d", m.Version)
+	}
+	switch m.Kind {
+	case ITOReportVerifiedTest:
+		if len(m.VerificationToken) == 0 {
+			return errors.New("Verified test report without verification token")
+		}
+	case ITOReportSymptoms:
+		if m.Symptoms == 0 {
+			return errors.New("Symptoms report without symptoms")
+		}
+	default:
+		return fmt.Errorf("Unknown ito report kind %d", m.Kind)
+	}
+	if m.Symptoms&^ITOSymptomsAll != 0 {
+		return errors.New("Unknown symptoms in ito memo")
+	}
+	if len(m.VerificationToken) > ITOMemoMaxTokenLength {
+		return errors.New("Verification token too long")
+	}
+	return nil
+}
+
+// Bytes returns the encoded memo data.
+func (m *ITOMemo) Bytes() ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, ITOMemoHeaderLength, ITOMemoHeaderLength+len(m.VerificationToken))
+	data[0] = m.Version
+	data[1] = uint8(m.Kind)
+	binary.LittleEndian.PutUint16(data[2:4], m.OnsetBucket)
+	binary.LittleEndian.PutUint32(data[4:8], uint32(m.Symptoms))
+	data[8] = uint8(len(m.VerificationToken))
+	data = append(data, m.VerificationToken...)
+	return data, nil
+}
+
+// Memo returns m as a memo of type ITOMemoCode.
+func (m *ITOMemo) Memo() (*Memo, error) {
+	data, err := m.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return GenerateMemo(data)
+}
+
+// DecodeITOMemo decodes and validates the data of an ito memo.
+func DecodeITOMemo(data []byte) (*ITOMemo, error) {
+	if len(data) < ITOMemoHeaderLength {
+		return nil, errors.New("Data too short to be a valid ito memo")
+	}
+
+	tokenLen := int(data[8])
+	if len(data) != ITOMemoHeaderLength+tokenLen {
+		return nil, errors.New("Invalid ito memo token length")
+	}
+
+	m := &ITOMemo{
+		Version:           data[0],
+		Kind:              ITOReportKind(data[1]),
+		OnsetBucket:       binary.LittleEndian.Uint16(data[2:4]),
+		Symptoms:          ITOSymptoms(binary.LittleEndian.Uint32(data[4:8])),
+		VerificationToken: data[ITOMemoHeaderLength:],
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// String returns the name of the report kind.
+func (k ITOReportKind) String() string {
+	switch k {
+	case ITOReportVerifiedTest:
+		return "verified_test"
+	case ITOReportSymptoms:
+		return "symptoms"
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(k))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (k ITOReportKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Names returns the names of the symptoms contained in s.
+func (s ITOSymptoms) Names() []string {
+	names := []string{}
+	for i, name := range itoSymptomNames {
+		if s&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// MarshalJSON implements json.Marshaler. Symptoms are represented by their
+// names.
+func (s ITOSymptoms) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Names())
+}
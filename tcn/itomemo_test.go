@@ -0,0 +1,88 @@
+package tcn_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestITOMemoRoundTrip(t *testing.T) {
+	for _, m := range []*tcn.ITOMemo{
+		{
+			Version:     tcn.ITOMemoVersion,
+			Kind:        tcn.ITOReportSymptoms,
+			OnsetBucket: tcn.OnsetBucketFromTime(time.Date(2020, 4, 20, 13, 0, 0, 0, time.UTC)),
+			Symptoms:    tcn.ITOSymptomFever | tcn.ITOSymptomCough,
+		},
+		{
+			Version:           tcn.ITOMemoVersion,
+			Kind:              tcn.ITOReportVerifiedTest,
+			VerificationToken: []byte("token"),
+		},
+		{
+			Version:           tcn.ITOMemoVersion,
+			Kind:              tcn.ITOReportVerifiedTest,
+			Symptoms:          tcn.ITOSymptomsAll,
+			VerificationToken: bytes.Repeat([]byte{0xff}, tcn.ITOMemoMaxTokenLength),
+		},
+	} {
+		memo, err := m.Memo()
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		assert.Equal(t, uint8(tcn.ITOMemoCode), memo.Type)
+		assert.True(t, len(memo.Data) <= 255)
+		assert.NoError(t, tcn.ValidateMemo(memo))
+
+		retMemo, err := tcn.DecodeITOMemo(memo.Data)
+		assert.NoError(t, err)
+		if len(m.VerificationToken) == 0 {
+			m.VerificationToken = []byte{}
+		}
+		assert.EqualValues(t, m, retMemo)
+	}
+}
+
+func TestITOMemoOnset(t *testing.T) {
+	m := &tcn.ITOMemo{
+		OnsetBucket: tcn.OnsetBucketFromTime(time.Date(2020, 4, 20, 13, 0, 0, 0, time.UTC)),
+	}
+	assert.Equal(t, time.Date(2020, 4, 20, 0, 0, 0, 0, time.UTC), m.Onset())
+	assert.True(t, (&tcn.ITOMemo{}).Onset().IsZero())
+}
+
+func TestITOMemoInvalid(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		[]byte("symptom data"),
+		// Unsupported version
+		{0x2, 0x2, 0, 0, 0x1, 0, 0, 0, 0},
+		// Unknown kind
+		{0x1, 0x3, 0, 0, 0x1, 0, 0, 0, 0},
+		// Symptoms report without symptoms
+		{0x1, 0x2, 0, 0, 0, 0, 0, 0, 0},
+		// Unknown symptom
+		{0x1, 0x2, 0, 0, 0, 0, 0, 0x80, 0},
+		// Verified test without token
+		{0x1, 0x1, 0, 0, 0, 0, 0, 0, 0},
+		// Token length doesn't match
+		{0x1, 0x1, 0, 0, 0, 0, 0, 0, 2, 0xaa},
+		// Trailing data
+		{0x1, 0x2, 0, 0, 0x1, 0, 0, 0, 0, 0xaa},
+	} {
+		_, err := tcn.DecodeITOMemo(data)
+		assert.Error(t, err, "%x", data)
+		assert.Error(t, tcn.ValidateMemo(&tcn.Memo{Type: tcn.ITOMemoCode, Len: uint8(len(data)), Data: data}))
+	}
+
+	_, err := (&tcn.ITOMemo{
+		Version:           tcn.ITOMemoVersion,
+		Kind:              tcn.ITOReportVerifiedTest,
+		VerificationToken: make([]byte, tcn.ITOMemoMaxTokenLength+1),
+	}).Bytes()
+	assert.Error(t, err)
+}
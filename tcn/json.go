@@ -0,0 +1,130 @@
+package tcn
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+)
+
+// memoJSON is the JSON representation of a Memo. Data is base64 encoded by
+// encoding/json. Decoded holds the decoded data if the memo type has a
+// decoder; it's ignored when unmarshaling.
+type memoJSON struct {
+	Type    uint8       `json:"type"`
+	Data    []byte      `json:"data"`
+	Decoded interface{} `json:"decoded,omitempty"`
+}
+
+// reportJSON is the JSON representation of a Report. Keys are base64
+// encoded and the memo is represented as its own object.
+type reportJSON struct {
+	RVK  []byte `json:"rvk"`
+	TCK  []byte `json:"tck"`
+	J1   uint16 `json:"j1"`
+	J2   uint16 `json:"j2"`
+	Memo *Memo  `json:"memo"`
+}
+
+// signedReportJSON is the JSON representation of a SignedReport.
+type signedReportJSON struct {
+	Report *Report `json:"report"`
+	Sig    []byte  `json:"sig"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m *Memo) MarshalJSON() ([]byte, error) {
+	data := m.Data
+	if data == nil {
+		data = []byte{}
+	}
+	// Memos that fail to decode are still returned with their raw data.
+	decoded, _ := DecodeMemo(m)
+	return json.Marshal(&memoJSON{
+		Type:    m.Type,
+		Data:    data,
+		Decoded: decoded,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The memo length is derived from
+// the data.
+func (m *Memo) UnmarshalJSON(b []byte) error {
+	var mj memoJSON
+	if err := json.Unmarshal(b, &mj); err != nil {
+		return err
+	}
+	if len(mj.Data) > 255 {
+		return errors.New("Data field contains too many bytes")
+	}
+	if mj.Data == nil {
+		mj.Data = []byte{}
+	}
+	m.Type = mj.Type
+	m.Len = uint8(len(mj.Data))
+	m.Data = mj.Data
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *Report) MarshalJSON() ([]byte, error) {
+	if r.Memo == nil {
+		return nil, errors.New("Failed to create JSON representation of report: memo field is null")
+	}
+	return json.Marshal(&reportJSON{
+		RVK:  r.RVK,
+		TCK:  r.TCKBytes[:],
+		J1:   r.J1,
+		J2:   r.J2,
+		Memo: r.Memo,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *Report) UnmarshalJSON(b []byte) error {
+	var rj reportJSON
+	if err := json.Unmarshal(b, &rj); err != nil {
+		return err
+	}
+	if len(rj.RVK) != ed25519.PublicKeySize {
+		return errors.New("Invalid rvk length")
+	}
+	if len(rj.TCK) != 32 {
+		return errors.New("Invalid tck length")
+	}
+	if rj.Memo == nil {
+		return errors.New("Memo field is missing")
+	}
+
+	r.RVK = ed25519.PublicKey(rj.RVK)
+	copy(r.TCKBytes[:], rj.TCK)
+	r.J1 = rj.J1
+	r.J2 = rj.J2
+	r.Memo = rj.Memo
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (sr *SignedReport) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&signedReportJSON{
+		Report: sr.Report,
+		Sig:    sr.Sig,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (sr *SignedReport) UnmarshalJSON(b []byte) error {
+	var srj signedReportJSON
+	if err := json.Unmarshal(b, &srj); err != nil {
+		return err
+	}
+	if srj.Report == nil {
+		return errors.New("Report field is missing")
+	}
+	if len(srj.Sig) != ed25519.SignatureSize {
+		return errors.New("Invalid signature length")
+	}
+
+	sr.Report = srj.Report
+	sr.Sig = srj.Sig
+	return nil
+}
@@ -0,0 +1,47 @@
+package tcn_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedReportJSON(t *testing.T) {
+	_, rak, report, err := tcn.GenerateReport(0, 4, []byte("symptom data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	signedReport, err := tcn.GenerateSignedReport(rak, report)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	b, err := json.Marshal(signedReport)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	retSignedReport := &tcn.SignedReport{}
+	assert.NoError(t, json.Unmarshal(b, retSignedReport))
+	assert.EqualValues(t, signedReport, retSignedReport)
+
+	ok, err := retSignedReport.Verify()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestSignedReportJSONInvalid(t *testing.T) {
+	for _, data := range []string{
+		`{"report":{"rvk":"AAAA","tck":"AAAA","j1":0,"j2":1,"memo":{"type":2,"data":""}},"sig":"AAAA"}`,
+		`{"sig":"AAAA"}`,
+		`{"report":{"j1":0,"j2":1}}`,
+	} {
+		signedReport := &tcn.SignedReport{}
+		assert.Error(t, json.Unmarshal([]byte(data), signedReport), data)
+	}
+}
@@ -0,0 +1,92 @@
+package tcn
+
+import (
+	"time"
+)
+
+// Observation is a temporary contact number observed by a client together
+// with the time it was observed.
+type Observation struct {
+	TCN        TemporaryContactNumber
+	ObservedAt time.Time
+}
+
+// Match is an observation whose TCN is covered by a signed report.
+type Match struct {
+	Observation  Observation
+	SignedReport *SignedReport
+	// Memo is the decoded memo of the report as returned by DecodeMemo. It's
+	// nil if the memo type has no decoder or the memo couldn't be decoded.
+	Memo interface{}
+}
+
+// Matcher checks signed reports for TCNs observed by a client. It's not
+// safe for concurrent use.
+type Matcher struct {
+	observations map[TemporaryContactNumber][]time.Time
+}
+
+// NewMatcher returns a matcher for the given observations.
+func NewMatcher(observations []Observation) *Matcher {
+	m := &Matcher{
+		observations: make(map[TemporaryContactNumber][]time.Time, len(observations)),
+	}
+	for _, o := range observations {
+		m.Add(o)
+	}
+	return m
+}
+
+// Add adds an observation to the matcher.
+func (m *Matcher) Add(o Observation) {
+	m.observations[o.TCN] = append(m.observations[o.TCN], o.ObservedAt)
+}
+
+// Len returns the number of distinct observed TCNs.
+func (m *Matcher) Len() int {
+	return len(m.observations)
+}
+
+// Match returns a match for every observation of a TCN that's covered by one
+// of signedReports. Reports that are invalid or whose signature can't be
+// verified are skipped. Signatures are only verified for reports that cover
+// observed TCNs.
+func (m *Matcher) Match(signedReports []*SignedReport) []*Match {
+	matches := []*Match{}
+	for _, sr := range signedReports {
+		if sr == nil || sr.Report == nil {
+			continue
+		}
+		tcns, err := sr.Report.TemporaryContactNumbers()
+		if err != nil {
+			continue
+		}
+
+		var reportMatches []*Match
+		for _, tcn := range tcns {
+			for _, t := range m.observations[tcn] {
+				reportMatches = append(reportMatches, &Match{
+					Observation: Observation{
+						TCN:        tcn,
+						ObservedAt: t,
+					},
+					SignedReport: sr,
+				})
+			}
+		}
+		if len(reportMatches) == 0 {
+			continue
+		}
+
+		if ok, err := sr.Verify(); err != nil || !ok {
+			continue
+		}
+		// Memos that fail to decode are still returned with the report.
+		memo, _ := DecodeMemo(sr.Report.Memo)
+		for _, match := range reportMatches {
+			match.Memo = memo
+		}
+		matches = append(matches, reportMatches...)
+	}
+	return matches
+}
@@ -0,0 +1,214 @@
+package tcn_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+// clientTCNs returns the TCNs a client with the given keys broadcasts, i.e.
+// tcn_1 to tcn_n. Index i of the result holds tcn_{i+1}.
+func clientTCNs(t testing.TB, rvk *ed25519.PublicKey, rak *ed25519.PrivateKey, n int) []tcn.TemporaryContactNumber {
+	tck0Hash := sha256.New()
+	tck0Hash.Write([]byte(tcn.HTCKDomainSep))
+	tck0Hash.Write(*rak)
+
+	tck := &tcn.TemporaryContactKey{
+		Index: 0,
+		RVK:   *rvk,
+	}
+	copy(tck.TCKBytes[:], tck0Hash.Sum(nil))
+
+	tcns := []tcn.TemporaryContactNumber{}
+	for i := 0; i < n; i++ {
+		var err error
+		tck, err = tck.Ratchet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := tck.TemporaryContactNumber()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tcns = append(tcns, c)
+	}
+	return tcns
+}
+
+func TestReportTemporaryContactNumbers(t *testing.T) {
+	rvk, rak, report, err := tcn.GenerateReport(3, 7, []byte("symptom data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	tcns, err := report.TemporaryContactNumbers()
+	assert.NoError(t, err)
+	// The report covers tcn_3 to tcn_6
+	assert.Equal(t, clientTCNs(t, rvk, rak, 6)[2:], tcns)
+}
+
+func TestMatcher(t *testing.T) {
+	rvk, rak, report, err := tcn.GenerateReport(2, 5, []byte("symptom data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	signedReport, err := tcn.GenerateSignedReport(rak, report)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	// A report with a valid range but an invalid signature covering the
+	// same TCNs
+	forgedReport := *report
+	forgedSignedReport := &tcn.SignedReport{
+		Report: &forgedReport,
+		Sig:    make([]byte, ed25519.SignatureSize),
+	}
+
+	tcns := clientTCNs(t, rvk, rak, 6)
+	observedAt := time.Unix(1587400000, 0)
+	matcher := tcn.NewMatcher([]tcn.Observation{
+		// tcn_1 isn't covered by the report
+		{TCN: tcns[0], ObservedAt: observedAt},
+		{TCN: tcns[2], ObservedAt: observedAt},
+		{TCN: tcns[2], ObservedAt: observedAt.Add(time.Minute)},
+		// tcn_5 isn't covered by the report
+		{TCN: tcns[4], ObservedAt: observedAt},
+	})
+	assert.Equal(t, 3, matcher.Len())
+
+	matches := matcher.Match([]*tcn.SignedReport{forgedSignedReport, signedReport, nil})
+	assert.Len(t, matches, 2)
+	for _, m := range matches {
+		assert.Equal(t, tcns[2], m.Observation.TCN)
+		assert.Equal(t, signedReport, m.SignedReport)
+	}
+	assert.Equal(t, observedAt, matches[0].Observation.ObservedAt)
+	assert.Equal(t, observedAt.Add(time.Minute), matches[1].Observation.ObservedAt)
+}
+
+func TestExposureChecker(t *testing.T) {
+	rvk, rak, report, err := tcn.GenerateReport(1, 3, []byte("symptom data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	signedReport, err := tcn.GenerateSignedReport(rak, report)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	data, err := signedReport.Bytes()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	tcns := clientTCNs(t, rvk, rak, 1)
+	ec := tcn.NewExposureChecker()
+	assert.Error(t, ec.AddObservation([]byte{0x1}, 0))
+	assert.NoError(t, ec.AddObservation(tcns[0][:], 1587400000))
+
+	n, err := ec.CheckReports(data)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, ec.MatchCount())
+	observedAt, err := ec.MatchObservedAt(0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1587400000), observedAt)
+	matchTCN, err := ec.MatchTCN(0)
+	assert.NoError(t, err)
+	assert.Equal(t, tcns[0][:], matchTCN)
+	memoType, err := ec.MatchMemoType(0)
+	assert.NoError(t, err)
+	assert.Equal(t, int(tcn.ITOMemoCode), memoType)
+	memoData, err := ec.MatchMemoData(0)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("symptom data"), memoData)
+	b, err := ec.MatchSignedReport(0)
+	assert.NoError(t, err)
+	assert.Equal(t, data, b)
+
+	// Invalid indices return errors instead of panicking.
+	for _, i := range []int{-1, 1} {
+		_, err = ec.MatchObservedAt(i)
+		assert.Error(t, err)
+		_, err = ec.MatchTCN(i)
+		assert.Error(t, err)
+		_, err = ec.MatchMemoType(i)
+		assert.Error(t, err)
+		_, err = ec.MatchMemoData(i)
+		assert.Error(t, err)
+		_, err = ec.MatchSignedReport(i)
+		assert.Error(t, err)
+	}
+
+	_, err = ec.CheckReports(data[:10])
+	assert.Error(t, err)
+}
+
+const (
+	benchmarkReports      = 100000
+	benchmarkObservations = 10000
+	benchmarkReportKeys   = 4
+)
+
+var (
+	benchmarkOnce          sync.Once
+	benchmarkSignedReports []*tcn.SignedReport
+	benchmarkObserved      []tcn.Observation
+)
+
+// setupMatcherBenchmark creates the reports and observations for
+// BenchmarkMatcher. Every tenth report covers an observed TCN.
+func setupMatcherBenchmark(b *testing.B) {
+	benchmarkOnce.Do(func() {
+		for i := 0; i < benchmarkReports; i++ {
+			rvk, rak, report, err := tcn.GenerateReport(1, 1+benchmarkReportKeys, []byte("symptom data"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			sr, err := tcn.GenerateSignedReport(rak, report)
+			if err != nil {
+				b.Fatal(err)
+			}
+			benchmarkSignedReports = append(benchmarkSignedReports, sr)
+
+			if i%10 == 0 && len(benchmarkObserved) < benchmarkObservations {
+				benchmarkObserved = append(benchmarkObserved, tcn.Observation{
+					TCN:        clientTCNs(b, rvk, rak, 1)[0],
+					ObservedAt: time.Now(),
+				})
+			}
+		}
+		for len(benchmarkObserved) < benchmarkObservations {
+			o := tcn.Observation{ObservedAt: time.Now()}
+			if _, err := rand.Read(o.TCN[:]); err != nil {
+				b.Fatal(err)
+			}
+			benchmarkObserved = append(benchmarkObserved, o)
+		}
+	})
+}
+
+func BenchmarkMatcher(b *testing.B) {
+	setupMatcherBenchmark(b)
+	matcher := tcn.NewMatcher(benchmarkObserved)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		matches := matcher.Match(benchmarkSignedReports)
+		if len(matches) != benchmarkReports/10 {
+			b.Fatalf("Expected %d matches, got %d", benchmarkReports/10, len(matches))
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package tcn
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// CoEpiMemoCode is the memo type of CoEpi symptom reports.
+	CoEpiMemoCode = 0x0
+	// CovidWatchMemoCode is the memo type of CovidWatch test results.
+	CovidWatchMemoCode = 0x1
+)
+
+// MemoType describes how the data of memos of one type is interpreted.
+type MemoType struct {
+	// Name is a human readable name of the memo type.
+	Name string
+	// Decode returns a structured representation of the memo data. It may be
+	// nil if the type has no such representation.
+	Decode func(data []byte) (interface{}, error)
+	// Validate returns an error if data isn't valid for this type. It may be
+	// nil if the type accepts any data.
+	Validate func(data []byte) error
+}
+
+var (
+	memoTypesMu sync.RWMutex
+	memoTypes   = map[uint8]*MemoType{}
+)
+
+func init() {
+	RegisterMemoType(CoEpiMemoCode, &MemoType{Name: "CoEpi"})
+	RegisterMemoType(CovidWatchMemoCode, &MemoType{Name: "CovidWatch"})
+	RegisterMemoType(ITOMemoCode, &MemoType{
+		Name:     "ito",
+		Decode:   decodeITOMemoData,
+		Validate: validateITOMemoData,
+	})
+}
+
+// RegisterMemoType makes a memo type known under code. It panics if code is
+// already registered.
+func RegisterMemoType(code uint8, memoType *MemoType) {
+	memoTypesMu.Lock()
+	defer memoTypesMu.Unlock()
+	if _, ok := memoTypes[code]; ok {
+		panic(fmt.Sprintf("tcn: memo type 0x%x registered twice", code))
+	}
+	memoTypes[code] = memoType
+}
+
+// LookupMemoType returns the memo type registered under code.
+func LookupMemoType(code uint8) (*MemoType, bool) {
+	memoTypesMu.RLock()
+	defer memoTypesMu.RUnlock()
+	memoType, ok := memoTypes[code]
+	return memoType, ok
+}
+
+// ValidateMemo checks that m has a registered type and that its data is
+// valid for that type.
+func ValidateMemo(m *Memo) error {
+	if int(m.Len) != len(m.Data) {
+		return fmt.Errorf("Memo length %d doesn't match data length %d", m.Len, len(m.Data))
+	}
+	memoType, ok := LookupMemoType(m.Type)
+	if !ok {
+		return fmt.Errorf("Unknown memo type 0x%x", m.Type)
+	}
+	if memoType.Validate == nil {
+		return nil
+	}
+	return memoType.Validate(m.Data)
+}
+
+// DecodeMemo returns the structured representation of m's data as returned
+// by the Decode function of its memo type. It returns nil if the type has no
+// decoder.
+func DecodeMemo(m *Memo) (interface{}, error) {
+	memoType, ok := LookupMemoType(m.Type)
+	if !ok {
+		return nil, fmt.Errorf("Unknown memo type 0x%x", m.Type)
+	}
+	if memoType.Decode == nil {
+		return nil, nil
+	}
+	return memoType.Decode(m.Data)
+}
@@ -0,0 +1,51 @@
+package tcn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMemo(t *testing.T) {
+	assert.NoError(t, tcn.ValidateMemo(&tcn.Memo{Type: tcn.CoEpiMemoCode, Len: 1, Data: []byte{0x1}}))
+	assert.NoError(t, tcn.ValidateMemo(&tcn.Memo{Type: tcn.CovidWatchMemoCode, Len: 0, Data: []byte{}}))
+
+	// Length doesn't match data
+	assert.Error(t, tcn.ValidateMemo(&tcn.Memo{Type: tcn.CoEpiMemoCode, Len: 2, Data: []byte{0x1}}))
+	// Unknown memo type
+	assert.Error(t, tcn.ValidateMemo(&tcn.Memo{Type: 0xfe, Len: 0, Data: []byte{}}))
+}
+
+func TestRegisterMemoType(t *testing.T) {
+	const testMemoCode = 0xf0
+	tcn.RegisterMemoType(testMemoCode, &tcn.MemoType{
+		Name: "test",
+		Decode: func(data []byte) (interface{}, error) {
+			return string(data), nil
+		},
+		Validate: func(data []byte) error {
+			if len(data) == 0 {
+				return errors.New("empty")
+			}
+			return nil
+		},
+	})
+
+	memoType, ok := tcn.LookupMemoType(testMemoCode)
+	assert.True(t, ok)
+	assert.Equal(t, "test", memoType.Name)
+
+	assert.Error(t, tcn.ValidateMemo(&tcn.Memo{Type: testMemoCode, Len: 0, Data: []byte{}}))
+	memo := &tcn.Memo{Type: testMemoCode, Len: 3, Data: []byte("abc")}
+	assert.NoError(t, tcn.ValidateMemo(memo))
+
+	decoded, err := tcn.DecodeMemo(memo)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", decoded)
+
+	assert.Panics(t, func() {
+		tcn.RegisterMemoType(testMemoCode, &tcn.MemoType{Name: "duplicate"})
+	})
+}
@@ -0,0 +1,110 @@
+package tcn
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ExposureChecker wraps Matcher in an API that only uses types supported by
+// gomobile bind, so it can be used from the Android and iOS apps.
+type ExposureChecker struct {
+	matcher *Matcher
+	matches []*Match
+}
+
+// NewExposureChecker returns an exposure checker without observations.
+func NewExposureChecker() *ExposureChecker {
+	return &ExposureChecker{
+		matcher: NewMatcher(nil),
+	}
+}
+
+// AddObservation adds a TCN that was observed at the given Unix time in
+// seconds.
+func (ec *ExposureChecker) AddObservation(tcn []byte, observedAt int64) error {
+	o := Observation{
+		ObservedAt: time.Unix(observedAt, 0),
+	}
+	if len(tcn) != len(o.TCN) {
+		return errors.New("Invalid TCN length")
+	}
+	copy(o.TCN[:], tcn)
+	ec.matcher.Add(o)
+	return nil
+}
+
+// CheckReports checks the signed reports in data, concatenated in the TCN
+// wire format as returned by the server, for observed TCNs. It returns the
+// number of new matches, which are appended to the existing matches.
+func (ec *ExposureChecker) CheckReports(data []byte) (int, error) {
+	signedReports, err := GetSignedReports(data)
+	if err != nil {
+		return 0, err
+	}
+	matches := ec.matcher.Match(signedReports)
+	ec.matches = append(ec.matches, matches...)
+	return len(matches), nil
+}
+
+// MatchCount returns the number of matches found so far.
+func (ec *ExposureChecker) MatchCount() int {
+	return len(ec.matches)
+}
+
+// match returns match i or an error if there's none, so that invalid
+// indices raise an exception in the app instead of crashing it.
+func (ec *ExposureChecker) match(i int) (*Match, error) {
+	if i < 0 || i >= len(ec.matches) {
+		return nil, fmt.Errorf("Invalid match index %d, %d matches were found", i, len(ec.matches))
+	}
+	return ec.matches[i], nil
+}
+
+// MatchObservedAt returns the Unix time in seconds at which the TCN of match
+// i was observed.
+func (ec *ExposureChecker) MatchObservedAt(i int) (int64, error) {
+	m, err := ec.match(i)
+	if err != nil {
+		return 0, err
+	}
+	return m.Observation.ObservedAt.Unix(), nil
+}
+
+// MatchTCN returns the TCN of match i.
+func (ec *ExposureChecker) MatchTCN(i int) ([]byte, error) {
+	m, err := ec.match(i)
+	if err != nil {
+		return nil, err
+	}
+	tcn := m.Observation.TCN
+	return tcn[:], nil
+}
+
+// MatchMemoType returns the memo type of the report of match i.
+func (ec *ExposureChecker) MatchMemoType(i int) (int, error) {
+	m, err := ec.match(i)
+	if err != nil {
+		return 0, err
+	}
+	return int(m.SignedReport.Report.Memo.Type), nil
+}
+
+// MatchMemoData returns the memo data of the report of match i.
+func (ec *ExposureChecker) MatchMemoData(i int) ([]byte, error) {
+	m, err := ec.match(i)
+	if err != nil {
+		return nil, err
+	}
+	return m.SignedReport.Report.Memo.Data, nil
+}
+
+// MatchSignedReport returns the signed report of match i in the TCN wire
+// format.
+func (ec *ExposureChecker) MatchSignedReport(i int) ([]byte, error) {
+	m, err := ec.match(i)
+	if err != nil {
+		return nil, err
+	}
+	return m.SignedReport.Bytes()
+}
@@ -7,74 +7,84 @@ import (
 )
 
 // GetSignedReport interprets data as a signed report and returns it as a
-// parsed structure.
+// parsed structure. Data following the signed report is ignored.
 func GetSignedReport(data []byte) (*SignedReport, error) {
 	if len(data) < SignedReportMinLength {
 		return nil, errors.New("Data too short to be a valid signed report")
 	}
 
-	signedReport, _ := getSignedReport(data)
-	return signedReport, nil
+	signedReport, _, err := getSignedReport(data)
+	return signedReport, err
 }
 
 // getSignedReport returns the signed report contained in data and returns it
 // in combination with its length (end position), which allows for parsing of
 // multiple signed reports.
-func getSignedReport(data []byte) (*SignedReport, uint16) {
-	report, reportEndPos := getReport(data)
+func getSignedReport(data []byte) (*SignedReport, int, error) {
+	report, reportEndPos, err := getReport(data)
+	if err != nil {
+		return nil, 0, err
+	}
 	endPos := reportEndPos + ed25519.SignatureSize
+	if len(data) < endPos {
+		return nil, 0, errors.New("Data too short to contain the report's signature")
+	}
 	sig := data[reportEndPos:endPos]
 	return &SignedReport{
 		Report: report,
 		Sig:    sig,
-	}, endPos
+	}, endPos, nil
 }
 
 // GetSignedReports gets all signed reports contained in a byte array and
-// returns them.
-func GetSignedReports(data []byte) []*SignedReport {
+// returns them. It fails if data doesn't consist of complete signed reports.
+func GetSignedReports(data []byte) ([]*SignedReport, error) {
 	signedReports := []*SignedReport{}
-	var startPos uint16
-	for {
-		signedReport, endPos := getSignedReport(data[startPos:])
+	startPos := 0
+	for startPos < len(data) {
+		signedReport, endPos, err := getSignedReport(data[startPos:])
+		if err != nil {
+			return nil, err
+		}
 		startPos += endPos
 		signedReports = append(signedReports, signedReport)
-		if int(startPos) >= len(data) {
-			// TODO: Fail if the startPos is greater than the length of data
-			// because this can only happen if something was wrong with the
-			// data (e.g. memo length field incorrect)
-			break
-		}
 	}
-	return signedReports
+	return signedReports, nil
 }
 
 // GetReport inteprets data as a report and returns it as a parsed structure.
+// Data following the report is ignored.
 func GetReport(data []byte) (*Report, error) {
 	if len(data) < ReportMinLength {
-		return nil, errors.New("Data too short to be a valid signed report")
+		return nil, errors.New("Data too short to be a valid report")
 	}
-	report, _ := getReport(data)
-	return report, nil
+	report, _, err := getReport(data)
+	return report, err
 }
 
 // getReport is the internal function for getting reports from byte arrays.
 // It returns the report contained in the data field and also returns the
 // length / end position of the array.
-func getReport(data []byte) (report *Report, endPos uint16) {
-	tckBytes := [32]byte{}
-	copy(tckBytes[:], data[32:64])
+func getReport(data []byte) (report *Report, endPos int, err error) {
+	if len(data) < ReportMinLength {
+		return nil, 0, errors.New("Data too short to be a valid report")
+	}
 
 	memoDataLen := uint8(data[69])
+	endPos = ReportMinLength + int(memoDataLen)
+	if len(data) < endPos {
+		return nil, 0, errors.New("Data too short to contain the report's memo")
+	}
+
+	tckBytes := [32]byte{}
+	copy(tckBytes[:], data[32:64])
 
 	memo := &Memo{
 		Type: data[68],
 		Len:  memoDataLen,
-		Data: data[70 : 70+memoDataLen],
+		Data: data[70:endPos],
 	}
 
-	// TODO: do some array bounds checking
-
 	report = &Report{
 		RVK:      ed25519.PublicKey(data[:32]),
 		TCKBytes: tckBytes,
@@ -83,25 +93,21 @@ func getReport(data []byte) (report *Report, endPos uint16) {
 		Memo:     memo,
 	}
 
-	endPos = 70 + uint16(memoDataLen)
-
-	return report, endPos
+	return report, endPos, nil
 }
 
-// GetReports gets all reports contained in a byte array and returns them.
-func GetReports(data []byte) []*Report {
+// GetReports gets all reports contained in a byte array and returns them. It
+// fails if data doesn't consist of complete reports.
+func GetReports(data []byte) ([]*Report, error) {
 	reports := []*Report{}
-	var startPos uint16
-	for {
-		report, endPos := getReport(data[startPos:])
+	startPos := 0
+	for startPos < len(data) {
+		report, endPos, err := getReport(data[startPos:])
+		if err != nil {
+			return nil, err
+		}
 		startPos += endPos
 		reports = append(reports, report)
-		if int(startPos) >= len(data) {
-			// TODO: Fail if the startPos is greater than the length of data
-			// because this can only happen if something was wrong with the
-			// data (e.g. memo length field incorrect)
-			break
-		}
 	}
-	return reports
+	return reports, nil
 }
@@ -24,7 +24,8 @@ func TestGetReports(t *testing.T) {
 		reportBytes = append(reportBytes, b...)
 	}
 
-	retReports := tcn.GetReports(reportBytes)
+	retReports, err := tcn.GetReports(reportBytes)
+	assert.NoError(t, err)
 
 	assert.Len(t, retReports, len(reports))
 	for i, rr := range retReports {
@@ -73,3 +74,57 @@ func TestGetSignedReport(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, signedReport, retSignedReport)
 }
+
+func TestGetSignedReports(t *testing.T) {
+	signedReports := [3]*tcn.SignedReport{}
+	data := []byte{}
+	for i := range signedReports {
+		_, rak, report, err := tcn.GenerateReport(0, 4, []byte("symptom data"))
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		signedReports[i], err = tcn.GenerateSignedReport(rak, report)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		b, err := signedReports[i].Bytes()
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		data = append(data, b...)
+	}
+
+	retSignedReports, err := tcn.GetSignedReports(data)
+	assert.NoError(t, err)
+	assert.Len(t, retSignedReports, len(signedReports))
+	for i, rsr := range retSignedReports {
+		assert.EqualValues(t, signedReports[i], rsr)
+	}
+
+	// Truncated feeds must fail instead of panicking
+	for _, l := range []int{1, tcn.ReportMinLength, len(data) - 1} {
+		_, err = tcn.GetSignedReports(data[:l])
+		assert.Error(t, err, "length %d", l)
+	}
+}
+
+func TestGetReportMemoTooLong(t *testing.T) {
+	_, _, report, err := tcn.GenerateReport(0, 1, []byte("symptom data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	rb, err := report.Bytes()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	// The memo length claims more data than there is
+	rb[69] = 0xff
+	_, err = tcn.GetReport(rb)
+	assert.Error(t, err)
+}
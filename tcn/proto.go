@@ -0,0 +1,112 @@
+package tcn
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"math"
+
+	"github.com/ito-org/go-backend/tcn/tcnpb"
+)
+
+// ToProto converts m to its protobuf representation.
+func (m *Memo) ToProto() *tcnpb.Memo {
+	return &tcnpb.Memo{
+		Type: uint32(m.Type),
+		Data: m.Data,
+	}
+}
+
+// MemoFromProto converts the protobuf representation of a memo to a Memo.
+func MemoFromProto(pm *tcnpb.Memo) (*Memo, error) {
+	if pm == nil {
+		return nil, errors.New("Memo field is missing")
+	}
+	if pm.Type > math.MaxUint8 {
+		return nil, errors.New("Invalid memo type")
+	}
+	if len(pm.Data) > 255 {
+		return nil, errors.New("Data field contains too many bytes")
+	}
+	data := pm.Data
+	if data == nil {
+		data = []byte{}
+	}
+	return &Memo{
+		Type: uint8(pm.Type),
+		Len:  uint8(len(data)),
+		Data: data,
+	}, nil
+}
+
+// ToProto converts r to its protobuf representation.
+func (r *Report) ToProto() *tcnpb.Report {
+	pr := &tcnpb.Report{
+		Rvk: r.RVK,
+		Tck: append([]byte{}, r.TCKBytes[:]...),
+		J1:  uint32(r.J1),
+		J2:  uint32(r.J2),
+	}
+	if r.Memo != nil {
+		pr.Memo = r.Memo.ToProto()
+	}
+	return pr
+}
+
+// ReportFromProto converts the protobuf representation of a report to a
+// Report.
+func ReportFromProto(pr *tcnpb.Report) (*Report, error) {
+	if pr == nil {
+		return nil, errors.New("Report field is missing")
+	}
+	if len(pr.Rvk) != ed25519.PublicKeySize {
+		return nil, errors.New("Invalid rvk length")
+	}
+	if len(pr.Tck) != 32 {
+		return nil, errors.New("Invalid tck length")
+	}
+	if pr.J1 > math.MaxUint16 || pr.J2 > math.MaxUint16 {
+		return nil, errors.New("Invalid key index")
+	}
+
+	memo, err := MemoFromProto(pr.Memo)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		RVK:  ed25519.PublicKey(pr.Rvk),
+		J1:   uint16(pr.J1),
+		J2:   uint16(pr.J2),
+		Memo: memo,
+	}
+	copy(report.TCKBytes[:], pr.Tck)
+	return report, nil
+}
+
+// ToProto converts sr to its protobuf representation.
+func (sr *SignedReport) ToProto() *tcnpb.SignedReport {
+	return &tcnpb.SignedReport{
+		Report: sr.Report.ToProto(),
+		Sig:    sr.Sig,
+	}
+}
+
+// SignedReportFromProto converts the protobuf representation of a signed
+// report to a SignedReport.
+func SignedReportFromProto(psr *tcnpb.SignedReport) (*SignedReport, error) {
+	if psr == nil {
+		return nil, errors.New("Signed report field is missing")
+	}
+	if len(psr.Sig) != ed25519.SignatureSize {
+		return nil, errors.New("Invalid signature length")
+	}
+
+	report, err := ReportFromProto(psr.Report)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedReport{
+		Report: report,
+		Sig:    psr.Sig,
+	}, nil
+}
@@ -0,0 +1,35 @@
+package tcn_test
+
+import (
+	"testing"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedReportProto(t *testing.T) {
+	_, rak, report, err := tcn.GenerateReport(0, 4, []byte("symptom data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	signedReport, err := tcn.GenerateSignedReport(rak, report)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	retSignedReport, err := tcn.SignedReportFromProto(signedReport.ToProto())
+	assert.NoError(t, err)
+	assert.EqualValues(t, signedReport, retSignedReport)
+
+	psr := signedReport.ToProto()
+	psr.Report.J1 = 1 << 16
+	_, err = tcn.SignedReportFromProto(psr)
+	assert.Error(t, err)
+
+	psr = signedReport.ToProto()
+	psr.Report.Memo = nil
+	_, err = tcn.SignedReportFromProto(psr)
+	assert.Error(t, err)
+}
@@ -0,0 +1,199 @@
+package tcn
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ReportAuthorizationKey is the secret key of a client as described in the
+// TCN protocol. All temporary contact keys and numbers of the client are
+// derived from it and it signs the client's reports.
+//
+// Besides deriving keys for arbitrary indices, a ReportAuthorizationKey
+// tracks the current temporary contact key, which is ratcheted forward with
+// NextTemporaryContactNumber. It's not safe for concurrent use.
+type ReportAuthorizationKey struct {
+	rak ed25519.PrivateKey
+	tck *TemporaryContactKey
+}
+
+// NewReportAuthorizationKey creates a report authorization key from
+// ed25519.SeedSize bytes read from r. If r is nil, crypto/rand.Reader is
+// used. Keys created from readers with the same output are equal, so tests
+// can pass a seeded reader to get reproducible keys.
+func NewReportAuthorizationKey(r io.Reader) (*ReportAuthorizationKey, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := io.ReadFull(r, seed); err != nil {
+		return nil, err
+	}
+	return NewReportAuthorizationKeyFromSeed(seed)
+}
+
+// NewReportAuthorizationKeyFromSeed creates the report authorization key of
+// an ed25519 seed (see ed25519.PrivateKey.Seed).
+func NewReportAuthorizationKeyFromSeed(seed []byte) (*ReportAuthorizationKey, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("Invalid seed length")
+	}
+	rak := ed25519.NewKeyFromSeed(seed)
+	return &ReportAuthorizationKey{
+		rak: rak,
+		tck: initialTemporaryContactKey(rak),
+	}, nil
+}
+
+// initialTemporaryContactKey derives tck_0 = H_tck(rak).
+func initialTemporaryContactKey(rak ed25519.PrivateKey) *TemporaryContactKey {
+	tck0Hash := sha256.New()
+	// Writes to a hash never fail.
+	_, _ = tck0Hash.Write([]byte(HTCKDomainSep))
+	_, _ = tck0Hash.Write(rak)
+
+	tck := &TemporaryContactKey{
+		Index: 0,
+		RVK:   rak.Public().(ed25519.PublicKey),
+	}
+	copy(tck.TCKBytes[:], tck0Hash.Sum(nil))
+	return tck
+}
+
+// PrivateKey returns the ed25519 private key, i.e. the rak.
+func (k *ReportAuthorizationKey) PrivateKey() ed25519.PrivateKey {
+	return k.rak
+}
+
+// VerificationKey returns the report verification key (rvk), the public key
+// of the rak.
+func (k *ReportAuthorizationKey) VerificationKey() ed25519.PublicKey {
+	return k.rak.Public().(ed25519.PublicKey)
+}
+
+// TemporaryContactKey returns tck_j, which is derived by ratcheting tck_0 j
+// times.
+func (k *ReportAuthorizationKey) TemporaryContactKey(j uint16) (*TemporaryContactKey, error) {
+	tck := initialTemporaryContactKey(k.rak)
+	for tck.Index < j {
+		var err error
+		tck, err = tck.Ratchet()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tck, nil
+}
+
+// TemporaryContactNumbers returns the TCNs with the indices j1 <= j < j2,
+// i.e. the TCNs covered by a report for [j1, j2).
+func (k *ReportAuthorizationKey) TemporaryContactNumbers(j1, j2 uint16) ([]TemporaryContactNumber, error) {
+	if err := validateKeyRange(j1, j2); err != nil {
+		return nil, err
+	}
+
+	tcns := make([]TemporaryContactNumber, 0, j2-j1)
+	if j1 == j2 {
+		return tcns, nil
+	}
+	tck, err := k.TemporaryContactKey(j1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tcn, err := tck.TemporaryContactNumber()
+		if err != nil {
+			return nil, err
+		}
+		tcns = append(tcns, tcn)
+		if tck.Index+1 >= j2 {
+			return tcns, nil
+		}
+		if tck, err = tck.Ratchet(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// CurrentTemporaryContactKey returns the current temporary contact key. It's
+// tck_0 for new keys.
+func (k *ReportAuthorizationKey) CurrentTemporaryContactKey() *TemporaryContactKey {
+	return k.tck
+}
+
+// NextTemporaryContactNumber ratchets the current temporary contact key and
+// returns the TCN of the new key together with its index. The first TCN has
+// the index 1. Once index 65535 was reached, the rak has to be rotated.
+func (k *ReportAuthorizationKey) NextTemporaryContactNumber() (TemporaryContactNumber, uint16, error) {
+	tck, err := k.tck.Ratchet()
+	if err != nil {
+		return TemporaryContactNumber{}, 0, err
+	}
+	tcn, err := tck.TemporaryContactNumber()
+	if err != nil {
+		return TemporaryContactNumber{}, 0, err
+	}
+	k.tck = tck
+	return tcn, tck.Index, nil
+}
+
+// CreateReport creates the report disclosing the TCNs with the indices
+// j1 <= j < j2. It contains tck_{j1-1}, from which the server and other
+// clients derive these TCNs.
+func (k *ReportAuthorizationKey) CreateReport(j1, j2 uint16, memo *Memo) (*Report, error) {
+	if err := validateKeyRange(j1, j2); err != nil {
+		return nil, err
+	}
+	if memo == nil {
+		return nil, errNilMemo
+	}
+	if int(memo.Len) != len(memo.Data) {
+		return nil, fmt.Errorf("Memo length %d doesn't match data length %d", memo.Len, len(memo.Data))
+	}
+	return k.createReport(j1, j2, memo)
+}
+
+// createReport creates the report for [j1, j2) without checking the key
+// range. Reports with j1 = 0 contain tck_0.
+func (k *ReportAuthorizationKey) createReport(j1, j2 uint16, memo *Memo) (*Report, error) {
+	var index uint16
+	if j1 > 0 {
+		index = j1 - 1
+	}
+	tck, err := k.TemporaryContactKey(index)
+	if err != nil {
+		return nil, err
+	}
+	return &Report{
+		RVK:      tck.RVK,
+		TCKBytes: tck.TCKBytes,
+		J1:       j1,
+		J2:       j2,
+		Memo:     memo,
+	}, nil
+}
+
+// CreateSignedReport creates the report for [j1, j2) like CreateReport and
+// signs it with the rak.
+func (k *ReportAuthorizationKey) CreateSignedReport(j1, j2 uint16, memo *Memo) (*SignedReport, error) {
+	report, err := k.CreateReport(j1, j2, memo)
+	if err != nil {
+		return nil, err
+	}
+	return GenerateSignedReport(&k.rak, report)
+}
+
+// validateKeyRange checks the key indices like Report.Validate.
+func validateKeyRange(j1, j2 uint16) error {
+	if j1 == 0 {
+		return ErrJ1Zero
+	}
+	if j2 < j1 {
+		return ErrInvalidKeyRange
+	}
+	return nil
+}
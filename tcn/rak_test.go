@@ -0,0 +1,325 @@
+package tcn_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSeed() []byte {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	return seed
+}
+
+func TestNewReportAuthorizationKey(t *testing.T) {
+	k1, err := tcn.NewReportAuthorizationKey(bytes.NewReader(testSeed()))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	k2, err := tcn.NewReportAuthorizationKeyFromSeed(testSeed())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assert.Equal(t, k1.PrivateKey(), k2.PrivateKey())
+	assert.Equal(t, testSeed(), k1.PrivateKey().Seed())
+	assert.Equal(t, k1.PrivateKey().Public(), k1.VerificationKey())
+
+	// Without reader, keys are random.
+	k3, err := tcn.NewReportAuthorizationKey(nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	k4, err := tcn.NewReportAuthorizationKey(nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assert.NotEqual(t, k3.PrivateKey(), k4.PrivateKey())
+
+	_, err = tcn.NewReportAuthorizationKey(bytes.NewReader(testSeed()[1:]))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	_, err = tcn.NewReportAuthorizationKeyFromSeed(testSeed()[1:])
+	assert.Error(t, err)
+}
+
+func TestGenerateReportFrom(t *testing.T) {
+	generate := func(seed int64) (*ed25519.PrivateKey, *tcn.Report) {
+		_, rak, report, err := tcn.GenerateReportFrom(rand.New(rand.NewSource(seed)), 2, 6, []byte("symptom data"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return rak, report
+	}
+
+	rak1, report1 := generate(1)
+	rak2, report2 := generate(1)
+	assert.Equal(t, rak1, rak2)
+	assert.Equal(t, report1, report2)
+
+	_, report3 := generate(2)
+	assert.NotEqual(t, report1.RVK, report3.RVK)
+
+	// Invalid key ranges are accepted, so that tests can upload invalid
+	// reports. Reports with j1 = 0 contain tck_0.
+	k, err := tcn.NewReportAuthorizationKey(rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	tck0, err := k.TemporaryContactKey(0)
+	assert.NoError(t, err)
+	_, _, report, err := tcn.GenerateReportFrom(rand.New(rand.NewSource(1)), 0, 4, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, tck0.TCKBytes, report.TCKBytes)
+	assert.Equal(t, tcn.ErrJ1Zero, report.Validate())
+	_, _, report, err = tcn.GenerateReportFrom(nil, 5, 4, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, tcn.ErrInvalidKeyRange, report.Validate())
+
+	// Signatures are deterministic as well.
+	sr1, err := tcn.GenerateSignedReport(rak1, report1)
+	assert.NoError(t, err)
+	sr2, err := tcn.GenerateSignedReport(rak2, report2)
+	assert.NoError(t, err)
+	assert.Equal(t, sr1, sr2)
+}
+
+func TestReportAuthorizationKeyTemporaryContactKeys(t *testing.T) {
+	k, err := tcn.NewReportAuthorizationKeyFromSeed(testSeed())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	// tck_0 = H_tck(rak)
+	tck0, err := k.TemporaryContactKey(0)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	tck0Hash := sha256.Sum256(append([]byte(tcn.HTCKDomainSep), k.PrivateKey()...))
+	assert.Equal(t, uint16(0), tck0.Index)
+	assert.Equal(t, tck0Hash, tck0.TCKBytes)
+	assert.Equal(t, k.VerificationKey(), tck0.RVK)
+	assert.Equal(t, tck0, k.CurrentTemporaryContactKey())
+
+	// tck_j is tck_0 ratcheted j times.
+	tck := tck0
+	for j := uint16(1); j <= 10; j++ {
+		tck, err = tck.Ratchet()
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		tckJ, err := k.TemporaryContactKey(j)
+		assert.NoError(t, err)
+		assert.Equal(t, tck, tckJ)
+	}
+}
+
+func TestReportAuthorizationKeyNextTemporaryContactNumber(t *testing.T) {
+	k, err := tcn.NewReportAuthorizationKeyFromSeed(testSeed())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	expected, err := k.TemporaryContactNumbers(1, 21)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assert.Equal(t, 20, len(expected))
+
+	for i := 0; i < 20; i++ {
+		tcnJ, j, err := k.NextTemporaryContactNumber()
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		assert.Equal(t, uint16(i+1), j)
+		assert.Equal(t, j, k.CurrentTemporaryContactKey().Index)
+		assert.Equal(t, expected[i], tcnJ)
+
+		tckJ, err := k.TemporaryContactKey(j)
+		assert.NoError(t, err)
+		tcnFromKey, err := tckJ.TemporaryContactNumber()
+		assert.NoError(t, err)
+		assert.Equal(t, tcnFromKey, tcnJ)
+	}
+}
+
+func TestReportAuthorizationKeyRotation(t *testing.T) {
+	k, err := tcn.NewReportAuthorizationKeyFromSeed(testSeed())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	_, err = k.TemporaryContactKey(math.MaxUint16)
+	assert.NoError(t, err)
+	tcns, err := k.TemporaryContactNumbers(math.MaxUint16-1, math.MaxUint16)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(tcns))
+
+	for j := 1; j <= math.MaxUint16; j++ {
+		if _, _, err := k.NextTemporaryContactNumber(); err != nil {
+			t.Error(err.Error())
+			return
+		}
+	}
+	assert.Equal(t, uint16(math.MaxUint16), k.CurrentTemporaryContactKey().Index)
+
+	// The rak has to be rotated once all TCKs were used.
+	_, _, err = k.NextTemporaryContactNumber()
+	assert.Error(t, err)
+	assert.Equal(t, uint16(math.MaxUint16), k.CurrentTemporaryContactKey().Index)
+}
+
+func TestReportAuthorizationKeyCreateReport(t *testing.T) {
+	k, err := tcn.NewReportAuthorizationKeyFromSeed(testSeed())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	memo, err := tcn.GenerateMemo([]byte("symptom data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	for _, tc := range []struct {
+		j1, j2 uint16
+	}{
+		{1, 1},
+		{1, 2},
+		{1, 97},
+		{5, 9},
+		{300, 400},
+	} {
+		report, err := k.CreateReport(tc.j1, tc.j2, memo)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		assert.NoError(t, report.Validate())
+		assert.Equal(t, tc.j1, report.J1)
+		assert.Equal(t, tc.j2, report.J2)
+
+		// The report matches the one created by GenerateReport for the same
+		// key and discloses exactly the TCNs of [j1, j2).
+		_, _, generated, err := tcn.GenerateReportFrom(bytes.NewReader(testSeed()), tc.j1, tc.j2, memo.Data)
+		assert.NoError(t, err)
+		assert.Equal(t, generated, report)
+
+		expected, err := k.TemporaryContactNumbers(tc.j1, tc.j2)
+		assert.NoError(t, err)
+		assert.Equal(t, int(tc.j2-tc.j1), len(expected))
+		tcns, err := report.TemporaryContactNumbers()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, tcns)
+
+		signedReport, err := k.CreateSignedReport(tc.j1, tc.j2, memo)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		assert.Equal(t, report, signedReport.Report)
+		ok, err := signedReport.Verify()
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+}
+
+func TestReportAuthorizationKeyLifecycle(t *testing.T) {
+	k, err := tcn.NewReportAuthorizationKey(rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	// A client broadcasts a TCN every 15 minutes; another client observes
+	// some of them.
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	observations := []tcn.Observation{}
+	for i := 0; i < 8; i++ {
+		tcnJ, j, err := k.NextTemporaryContactNumber()
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if j == 3 || j == 6 {
+			observations = append(observations, tcn.Observation{
+				TCN:        tcnJ,
+				ObservedAt: start.Add(time.Duration(j) * 15 * time.Minute),
+			})
+		}
+	}
+
+	memo, err := tcn.GenerateMemo([]byte("symptom data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	matcher := tcn.NewMatcher(observations)
+
+	// A report for [4, 9) only discloses the second observation.
+	signedReport, err := k.CreateSignedReport(4, 9, memo)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	matches := matcher.Match([]*tcn.SignedReport{signedReport})
+	assert.Equal(t, 1, len(matches))
+	assert.Equal(t, observations[1], matches[0].Observation)
+
+	signedReport, err = k.CreateSignedReport(1, 9, memo)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assert.Equal(t, 2, len(matcher.Match([]*tcn.SignedReport{signedReport})))
+}
+
+func TestReportAuthorizationKeyInvalid(t *testing.T) {
+	k, err := tcn.NewReportAuthorizationKeyFromSeed(testSeed())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	memo, err := tcn.GenerateMemo([]byte("symptom data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	_, err = k.CreateReport(0, 4, memo)
+	assert.Equal(t, tcn.ErrJ1Zero, err)
+	_, err = k.CreateReport(5, 4, memo)
+	assert.Equal(t, tcn.ErrInvalidKeyRange, err)
+	_, err = k.CreateReport(1, 4, nil)
+	assert.Error(t, err)
+	_, err = k.CreateReport(1, 4, &tcn.Memo{Type: tcn.ITOMemoCode, Len: 3, Data: []byte{1}})
+	assert.Error(t, err)
+
+	_, err = k.TemporaryContactNumbers(0, 4)
+	assert.Equal(t, tcn.ErrJ1Zero, err)
+	_, err = k.TemporaryContactNumbers(5, 4)
+	assert.Equal(t, tcn.ErrInvalidKeyRange, err)
+	_, err = k.CreateSignedReport(0, 4, memo)
+	assert.Equal(t, tcn.ErrJ1Zero, err)
+}
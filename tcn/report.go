@@ -2,10 +2,9 @@ package tcn
 
 import (
 	"crypto/ed25519"
-	"crypto/sha256"
-	"encoding/binary"
 	"errors"
-	"fmt"
+	"io"
+	"sync"
 )
 
 const (
@@ -15,6 +14,22 @@ const (
 	// ReportMinLength is the minimum length of a TCN report (with memo data
 	// of length 0) in bytes.
 	ReportMinLength = 70
+	// ReportMaxLength is the maximum length of a TCN report (with memo data
+	// of length 255) in bytes.
+	ReportMaxLength = ReportMinLength + 255
+)
+
+var errNilMemo = errors.New("Failed to create byte representation of report: memo field is null")
+
+var (
+	// ErrJ1Zero is returned for reports with j1 = 0. The protocol forbids
+	// this because a report contains tck_{j1-1}, and there is no tck_{-1}.
+	ErrJ1Zero = errors.New("Invalid report: j1 must be greater than 0")
+	// ErrInvalidKeyRange is returned for reports with j2 < j1.
+	ErrInvalidKeyRange = errors.New("Invalid report: j2 must not be smaller than j1")
+	// ErrKeySpanTooLarge is returned by ValidateSpan for reports covering
+	// more keys than allowed.
+	ErrKeySpanTooLarge = errors.New("Invalid report: report covers too many keys")
 )
 
 // Report represents a report as described in the TCN protocol:
@@ -35,29 +50,152 @@ type Memo struct {
 	Data []uint8 `db:"mdata"`
 }
 
+// AppendBytes appends the byte array representation of m to dst and returns
+// the extended buffer.
+func (m *Memo) AppendBytes(dst []byte) []byte {
+	dst = append(dst, m.Type, m.Len)
+	return append(dst, m.Data...)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (m *Memo) MarshalBinary() ([]byte, error) {
+	return m.AppendBytes(make([]byte, 0, 2+len(m.Data))), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. data must contain
+// exactly one memo.
+func (m *Memo) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || len(data) != 2+int(data[1]) {
+		return errors.New("Invalid memo length")
+	}
+	m.Type = data[0]
+	m.Len = data[1]
+	m.Data = append([]byte{}, data[2:]...)
+	return nil
+}
+
+// WriteTo implements io.WriterTo.
+func (m *Memo) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(w, func(buf []byte) ([]byte, error) {
+		return m.AppendBytes(buf), nil
+	})
+}
+
 // Bytes converts r to a concatenated byte array represention.
 func (r *Report) Bytes() ([]byte, error) {
-	var data []byte
-	data = append(data, r.RVK...)
-	data = append(data, r.TCKBytes[:]...)
+	if r.Memo == nil {
+		return nil, errNilMemo
+	}
+	return r.AppendBytes(make([]byte, 0, ReportMinLength+len(r.Memo.Data)))
+}
+
+// AppendBytes appends the byte array representation of r to dst and returns
+// the extended buffer.
+func (r *Report) AppendBytes(dst []byte) ([]byte, error) {
+	if r.Memo == nil {
+		return dst, errNilMemo
+	}
+
+	dst = append(dst, r.RVK...)
+	dst = append(dst, r.TCKBytes[:]...)
+	dst = append(dst, uint8(r.J1), uint8(r.J1>>8))
+	dst = append(dst, uint8(r.J2), uint8(r.J2>>8))
+	return r.Memo.AppendBytes(dst), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (r *Report) MarshalBinary() ([]byte, error) {
+	return r.Bytes()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. data must contain
+// exactly one report.
+func (r *Report) UnmarshalBinary(data []byte) error {
+	report, endPos, err := getReport(append([]byte{}, data...))
+	if err != nil {
+		return err
+	}
+	if endPos != len(data) {
+		return errors.New("Data contains more than one report")
+	}
+	*r = *report
+	return nil
+}
+
+// WriteTo implements io.WriterTo.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(w, r.AppendBytes)
+}
+
+// bufferPool holds buffers for serializing reports in WriteTo and Verify.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, SignedReportMaxLength)
+		return &buf
+	},
+}
+
+// writeTo writes the data appended by appendFn to w using a pooled buffer.
+func writeTo(w io.Writer, appendFn func([]byte) ([]byte, error)) (int64, error) {
+	bufp := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(bufp)
 
-	j1Bytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(j1Bytes, r.J1)
-	j2Bytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(j2Bytes, r.J2)
-	data = append(data, j1Bytes...)
-	data = append(data, j2Bytes...)
+	buf, err := appendFn((*bufp)[:0])
+	*bufp = buf
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
 
+// Validate checks that r conforms to the TCN protocol.
+func (r *Report) Validate() error {
+	if len(r.RVK) != ed25519.PublicKeySize {
+		return errors.New("Invalid report: invalid rvk length")
+	}
 	if r.Memo == nil {
-		return nil, errors.New("Failed to create byte representation of report: memo field is null")
+		return errors.New("Invalid report: memo field is null")
 	}
+	return validateKeyRange(r.J1, r.J2)
+}
 
-	// Memo
-	data = append(data, r.Memo.Type)
-	data = append(data, r.Memo.Len)
-	data = append(data, r.Memo.Data...)
+// TemporaryContactNumbers returns the TCNs covered by r, i.e. the TCNs with
+// the indices j1 <= j < j2. They are derived by ratcheting the tck_{j1-1}
+// contained in the report.
+func (r *Report) TemporaryContactNumbers() ([]TemporaryContactNumber, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
 
-	return data, nil
+	tck := &TemporaryContactKey{
+		Index:    r.J1 - 1,
+		RVK:      r.RVK,
+		TCKBytes: r.TCKBytes,
+	}
+	tcns := make([]TemporaryContactNumber, 0, r.J2-r.J1)
+	for j := r.J1; j < r.J2; j++ {
+		var err error
+		tck, err = tck.Ratchet()
+		if err != nil {
+			return nil, err
+		}
+		tcn, err := tck.TemporaryContactNumber()
+		if err != nil {
+			return nil, err
+		}
+		tcns = append(tcns, tcn)
+	}
+	return tcns, nil
+}
+
+// ValidateSpan returns ErrKeySpanTooLarge if r covers more than maxSpan
+// keys.
+func (r *Report) ValidateSpan(maxSpan uint16) error {
+	if r.J2 >= r.J1 && r.J2-r.J1 > maxSpan {
+		return ErrKeySpanTooLarge
+	}
+	return nil
 }
 
 // GenerateMemo returns a memo instance with the given content.
@@ -82,49 +220,31 @@ func GenerateMemo(content []byte) (*Memo, error) {
 	}, nil
 }
 
-// GenerateReport creates a public key, private key, and report according to TCN.
+// GenerateReport creates a public key, private key, and report according to
+// TCN. The report covers the TCNs j1 <= j < j2.
 func GenerateReport(j1, j2 uint16, memoData []byte) (*ed25519.PublicKey, *ed25519.PrivateKey, *Report, error) {
-	rvk, rak, err := ed25519.GenerateKey(nil)
-	if err != nil {
-		return nil, nil, nil, err
-	}
-
-	tck0Hash := sha256.New()
-	if _, err := tck0Hash.Write([]byte(HTCKDomainSep)); err != nil {
-		fmt.Printf("Failed to write tck domain separator: %s\n", err.Error())
-		return nil, nil, nil, err
-	}
-	if _, err := tck0Hash.Write(rak); err != nil {
-		fmt.Printf("Failed to write rak: %s\n", err.Error())
-		return nil, nil, nil, err
-	}
-
-	tck0Bytes := [32]byte{}
-	copy(tck0Bytes[:32], tck0Hash.Sum(nil))
-
-	tck0 := &TemporaryContactKey{
-		Index:    0,
-		RVK:      rvk,
-		TCKBytes: tck0Bytes,
-	}
+	return GenerateReportFrom(nil, j1, j2, memoData)
+}
 
-	tck1, err := tck0.Ratchet()
+// GenerateReportFrom works like GenerateReport but reads the key from r (see
+// NewReportAuthorizationKey), so that the result can be reproduced with a
+// seeded reader.
+func GenerateReportFrom(r io.Reader, j1, j2 uint16, memoData []byte) (*ed25519.PublicKey, *ed25519.PrivateKey, *Report, error) {
+	k, err := NewReportAuthorizationKey(r)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-
 	memo, err := GenerateMemo(memoData)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	report := &Report{
-		RVK:      rvk,
-		TCKBytes: tck1.TCKBytes,
-		J1:       j1,
-		J2:       j2,
-		Memo:     memo,
+	// Unlike ReportAuthorizationKey.CreateReport, invalid key ranges are
+	// accepted so that tests can create reports that must be rejected.
+	report, err := k.createReport(j1, j2, memo)
+	if err != nil {
+		return nil, nil, nil, err
 	}
-
-	return &rvk, &rak, report, nil
+	rvk := k.VerificationKey()
+	return &rvk, &k.rak, report, nil
 }
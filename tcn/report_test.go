@@ -0,0 +1,170 @@
+package tcn_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportValidate(t *testing.T) {
+	_, _, report, err := tcn.GenerateReport(1, 2, []byte("symptom data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	for _, tc := range []struct {
+		j1, j2 uint16
+		err    error
+	}{
+		{1, 2, nil},
+		{1, 1, nil},
+		{300, 65535, nil},
+		{0, 1, tcn.ErrJ1Zero},
+		{5, 4, tcn.ErrInvalidKeyRange},
+	} {
+		report.J1, report.J2 = tc.j1, tc.j2
+		assert.Equal(t, tc.err, report.Validate(), "j1=%d j2=%d", tc.j1, tc.j2)
+	}
+
+	report.J1, report.J2 = 1, 2
+	report.Memo = nil
+	assert.Error(t, report.Validate())
+}
+
+func TestReportValidateSpan(t *testing.T) {
+	_, _, report, err := tcn.GenerateReport(1, 101, []byte("symptom data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assert.NoError(t, report.ValidateSpan(100))
+	assert.Equal(t, tcn.ErrKeySpanTooLarge, report.ValidateSpan(99))
+}
+
+func TestSignedReportBinary(t *testing.T) {
+	_, rak, report, err := tcn.GenerateReport(1, 4, []byte("symptom data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	signedReport, err := tcn.GenerateSignedReport(rak, report)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	b, err := signedReport.MarshalBinary()
+	assert.NoError(t, err)
+
+	// AppendBytes keeps existing data
+	appended, err := signedReport.AppendBytes([]byte{0xaa})
+	assert.NoError(t, err)
+	assert.Equal(t, append([]byte{0xaa}, b...), appended)
+
+	var buf bytes.Buffer
+	n, err := signedReport.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(b)), n)
+	assert.Equal(t, b, buf.Bytes())
+
+	retSignedReport := &tcn.SignedReport{}
+	assert.NoError(t, retSignedReport.UnmarshalBinary(b))
+	assert.EqualValues(t, signedReport, retSignedReport)
+
+	// The unmarshaled report must not share memory with the input
+	b[0]++
+	assert.EqualValues(t, signedReport, retSignedReport)
+
+	assert.Error(t, retSignedReport.UnmarshalBinary(append(b, 0x0)))
+	assert.Error(t, retSignedReport.UnmarshalBinary(b[:len(b)-1]))
+}
+
+func TestReportBinary(t *testing.T) {
+	_, _, report, err := tcn.GenerateReport(1, 4, []byte("symptom data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	b, err := report.MarshalBinary()
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = report.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, b, buf.Bytes())
+
+	retReport := &tcn.Report{}
+	assert.NoError(t, retReport.UnmarshalBinary(b))
+	assert.EqualValues(t, report, retReport)
+	assert.Error(t, retReport.UnmarshalBinary(append(b, 0x0)))
+
+	memoBytes, err := report.Memo.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, b[tcn.ReportMinLength-2:], memoBytes)
+
+	retMemo := &tcn.Memo{}
+	assert.NoError(t, retMemo.UnmarshalBinary(memoBytes))
+	assert.EqualValues(t, report.Memo, retMemo)
+	assert.Error(t, retMemo.UnmarshalBinary(memoBytes[:len(memoBytes)-1]))
+
+	report.Memo = nil
+	_, err = report.MarshalBinary()
+	assert.Error(t, err)
+	_, err = report.WriteTo(&buf)
+	assert.Error(t, err)
+}
+
+func benchmarkSignedReport(b *testing.B) *tcn.SignedReport {
+	_, rak, report, err := tcn.GenerateReport(1, 4, []byte("symptom data"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	signedReport, err := tcn.GenerateSignedReport(rak, report)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return signedReport
+}
+
+func BenchmarkSignedReportBytes(b *testing.B) {
+	signedReport := benchmarkSignedReport(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := signedReport.Bytes(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSignedReportAppendBytes(b *testing.B) {
+	signedReport := benchmarkSignedReport(b)
+	buf := make([]byte, 0, tcn.SignedReportMaxLength)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = signedReport.AppendBytes(buf[:0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSignedReportWriteTo(b *testing.B) {
+	signedReport := benchmarkSignedReport(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := signedReport.WriteTo(ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
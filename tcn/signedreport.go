@@ -3,11 +3,15 @@ package tcn
 import (
 	"crypto"
 	"crypto/ed25519"
+	"errors"
+	"io"
 )
 
 const (
 	// SignedReportMinLength defines a signed report's minimum length in bytes
 	SignedReportMinLength = ReportMinLength + ed25519.SignatureSize
+	// SignedReportMaxLength defines a signed report's maximum length in bytes
+	SignedReportMaxLength = ReportMaxLength + ed25519.SignatureSize
 )
 
 // SignedReport contains a report and the corresponding signature. The client
@@ -22,14 +26,44 @@ type SignedReport struct {
 
 // Bytes converts sr to a concatenated byte array representation.
 func (sr *SignedReport) Bytes() ([]byte, error) {
-	var data []byte
-	b, err := sr.Report.Bytes()
+	if sr.Report.Memo == nil {
+		return nil, errNilMemo
+	}
+	return sr.AppendBytes(make([]byte, 0, SignedReportMinLength+len(sr.Report.Memo.Data)))
+}
+
+// AppendBytes appends the byte array representation of sr to dst and returns
+// the extended buffer.
+func (sr *SignedReport) AppendBytes(dst []byte) ([]byte, error) {
+	dst, err := sr.Report.AppendBytes(dst)
 	if err != nil {
-		return nil, err
+		return dst, err
+	}
+	return append(dst, sr.Sig...), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (sr *SignedReport) MarshalBinary() ([]byte, error) {
+	return sr.Bytes()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. data must contain
+// exactly one signed report.
+func (sr *SignedReport) UnmarshalBinary(data []byte) error {
+	signedReport, endPos, err := getSignedReport(append([]byte{}, data...))
+	if err != nil {
+		return err
 	}
-	data = append(data, b...)
-	data = append(data, sr.Sig...)
-	return data, nil
+	if endPos != len(data) {
+		return errors.New("Data contains more than one signed report")
+	}
+	*sr = *signedReport
+	return nil
+}
+
+// WriteTo implements io.WriterTo.
+func (sr *SignedReport) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(w, sr.AppendBytes)
 }
 
 // GenerateSignedReport signs a report with rak and returns the signed report.
@@ -53,7 +87,15 @@ func GenerateSignedReport(rak *ed25519.PrivateKey, report *Report) (*SignedRepor
 // Verify uses ed25519's Verify function to verify the signature over the
 // report.
 func (sr *SignedReport) Verify() (bool, error) {
-	reportBytes, err := sr.Report.Bytes()
+	if len(sr.Report.RVK) != ed25519.PublicKeySize {
+		return false, errors.New("Invalid rvk length")
+	}
+
+	bufp := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(bufp)
+
+	reportBytes, err := sr.Report.AppendBytes((*bufp)[:0])
+	*bufp = reportBytes
 	if err != nil {
 		return false, err
 	}
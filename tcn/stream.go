@@ -0,0 +1,73 @@
+package tcn
+
+import (
+	"bufio"
+	"io"
+)
+
+// Decoder reads signed reports in the TCN wire format from a stream of
+// concatenated signed reports.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns a decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		r: bufio.NewReader(r),
+	}
+}
+
+// Decode reads the next signed report from the stream into sr. It returns
+// io.EOF if the stream ended before the report and io.ErrUnexpectedEOF if it
+// ended within the report.
+func (d *Decoder) Decode(sr *SignedReport) error {
+	// The memo length is the last byte of the fixed size part of the report.
+	header, err := d.r.Peek(ReportMinLength)
+	if err != nil {
+		if err == io.EOF && len(header) > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	data := make([]byte, SignedReportMinLength+int(header[ReportMinLength-1]))
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	signedReport, _, err := getSignedReport(data)
+	if err != nil {
+		return err
+	}
+	*sr = *signedReport
+	return nil
+}
+
+// Encoder writes signed reports in the TCN wire format to a stream.
+type Encoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewEncoder returns an encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w:   w,
+		buf: make([]byte, 0, SignedReportMaxLength),
+	}
+}
+
+// Encode writes sr to the stream.
+func (e *Encoder) Encode(sr *SignedReport) error {
+	var err error
+	e.buf, err = sr.AppendBytes(e.buf[:0])
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(e.buf)
+	return err
+}
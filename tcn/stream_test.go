@@ -0,0 +1,52 @@
+package tcn_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	signedReports := generateSignedReports(t, 5)
+
+	var buf bytes.Buffer
+	enc := tcn.NewEncoder(&buf)
+	for _, sr := range signedReports {
+		if err := enc.Encode(sr); err != nil {
+			t.Error(err.Error())
+			return
+		}
+	}
+
+	data := append([]byte{}, buf.Bytes()...)
+	expected, err := tcn.GetSignedReports(data)
+	assert.NoError(t, err)
+
+	dec := tcn.NewDecoder(&buf)
+	for i := range signedReports {
+		sr := &tcn.SignedReport{}
+		assert.NoError(t, dec.Decode(sr))
+		assert.EqualValues(t, expected[i], sr)
+	}
+	assert.Equal(t, io.EOF, dec.Decode(&tcn.SignedReport{}))
+}
+
+func TestDecoderTruncated(t *testing.T) {
+	signedReports := generateSignedReports(t, 1)
+	b, err := signedReports[0].Bytes()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	for _, n := range []int{1, tcn.ReportMinLength, len(b) - 1} {
+		dec := tcn.NewDecoder(bytes.NewReader(b[:n]))
+		assert.Equal(t, io.ErrUnexpectedEOF, dec.Decode(&tcn.SignedReport{}))
+	}
+
+	dec := tcn.NewDecoder(bytes.NewReader(nil))
+	assert.Equal(t, io.EOF, dec.Decode(&tcn.SignedReport{}))
+}
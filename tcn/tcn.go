@@ -3,6 +3,7 @@ package tcn
 import (
 	"crypto/ed25519"
 	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
@@ -12,6 +13,10 @@ import (
 // function.
 const HTCKDomainSep = "H_TCK"
 
+// HTCNDomainSep is the domain separator used for deriving temporary contact
+// numbers from temporary contact keys.
+const HTCNDomainSep = "H_TCN"
+
 // TemporaryContactNumber is a pseudorandom 128-bit value broadcast to nearby
 // devices over Bluetooth
 type TemporaryContactNumber [16]uint8
@@ -54,3 +59,29 @@ func (tck *TemporaryContactKey) Ratchet() (*TemporaryContactKey, error) {
 		TCKBytes: newTCKBytes,
 	}, nil
 }
+
+// TemporaryContactNumber derives the temporary contact number of tck:
+// H_tcn(le_u16(j) || tck_j) truncated to 128 bits.
+func (tck *TemporaryContactKey) TemporaryContactNumber() (TemporaryContactNumber, error) {
+	tcn := TemporaryContactNumber{}
+
+	indexBytes := make([]byte, 2)
+	binary.LittleEndian.PutUint16(indexBytes, tck.Index)
+
+	tcnHash := sha256.New()
+	if _, err := tcnHash.Write([]byte(HTCNDomainSep)); err != nil {
+		fmt.Printf("Failed to write tcn domain separator: %s\n", err.Error())
+		return tcn, err
+	}
+	if _, err := tcnHash.Write(indexBytes); err != nil {
+		fmt.Printf("Failed to write tck index: %s\n", err.Error())
+		return tcn, err
+	}
+	if _, err := tcnHash.Write(tck.TCKBytes[:]); err != nil {
+		fmt.Printf("Failed to write tck bytes: %s\n", err.Error())
+		return tcn, err
+	}
+
+	copy(tcn[:], tcnHash.Sum(nil))
+	return tcn, nil
+}
@@ -0,0 +1,6 @@
+// Package tcnpb contains the protobuf representation of TCN reports and the
+// gRPC report service. Use the conversion functions in package tcn to convert
+// between these types and the tcn types.
+package tcnpb
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. tcn.proto
@@ -0,0 +1,82 @@
+package tcn
+
+import (
+	"crypto/ed25519"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// verifyChunkSize is the number of reports a worker of VerifyBatch takes at
+// once.
+const verifyChunkSize = 64
+
+// VerifyBatch verifies the signatures of signedReports concurrently using at
+// most workers goroutines, or runtime.NumCPU() goroutines if workers <= 0. It
+// returns the indices of the reports that failed verification in ascending
+// order. Reports that can't be serialized count as failed.
+func VerifyBatch(signedReports []*SignedReport, workers int) []int {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if maxWorkers := (len(signedReports) + verifyChunkSize - 1) / verifyChunkSize; workers > maxWorkers {
+		workers = maxWorkers
+	}
+
+	var (
+		next   int64
+		mu     sync.Mutex
+		failed = []int{}
+		wg     sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each worker serializes all its reports into the same buffer.
+			var buf []byte
+			var workerFailed []int
+			for {
+				start := int(atomic.AddInt64(&next, verifyChunkSize)) - verifyChunkSize
+				if start >= len(signedReports) {
+					break
+				}
+				end := start + verifyChunkSize
+				if end > len(signedReports) {
+					end = len(signedReports)
+				}
+				for i := start; i < end; i++ {
+					var ok bool
+					ok, buf = verifyWithBuffer(signedReports[i], buf[:0])
+					if !ok {
+						workerFailed = append(workerFailed, i)
+					}
+				}
+			}
+			mu.Lock()
+			failed = append(failed, workerFailed...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Ints(failed)
+	return failed
+}
+
+// verifyWithBuffer verifies sr using buf for the serialized report and
+// returns the buffer for reuse.
+func verifyWithBuffer(sr *SignedReport, buf []byte) (bool, []byte) {
+	if sr == nil || sr.Report == nil {
+		return false, buf
+	}
+	buf, err := sr.Report.AppendBytes(buf)
+	if err != nil {
+		return false, buf
+	}
+	if len(sr.Report.RVK) != ed25519.PublicKeySize {
+		return false, buf
+	}
+	return ed25519.Verify(sr.Report.RVK, buf, sr.Sig), buf
+}
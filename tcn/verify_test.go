@@ -0,0 +1,66 @@
+package tcn_test
+
+import (
+	"testing"
+
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+// generateSignedReports returns n valid signed reports.
+func generateSignedReports(t testing.TB, n int) []*tcn.SignedReport {
+	signedReports := make([]*tcn.SignedReport, n)
+	for i := range signedReports {
+		_, rak, report, err := tcn.GenerateReport(1, 2, []byte("symptom data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		signedReports[i], err = tcn.GenerateSignedReport(rak, report)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signedReports
+}
+
+func TestVerifyBatch(t *testing.T) {
+	signedReports := generateSignedReports(t, 300)
+
+	// Break some of the reports in different ways
+	signedReports[0].Sig = signedReports[1].Sig
+	signedReports[64].Report.J2++
+	signedReports[150] = nil
+	signedReports[299].Report.Memo = nil
+
+	for _, workers := range []int{0, 1, 3, 100} {
+		assert.Equal(t, []int{0, 64, 150, 299}, tcn.VerifyBatch(signedReports, workers), "workers=%d", workers)
+	}
+	assert.Equal(t, []int{}, tcn.VerifyBatch(signedReports[1:64], 0))
+	assert.Equal(t, []int{}, tcn.VerifyBatch(nil, 0))
+}
+
+const benchmarkVerifyReports = 10000
+
+func BenchmarkVerifySerial(b *testing.B) {
+	signedReports := generateSignedReports(b, benchmarkVerifyReports)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, sr := range signedReports {
+			if ok, err := sr.Verify(); err != nil || !ok {
+				b.Fatal("Verification failed")
+			}
+		}
+	}
+}
+
+func BenchmarkVerifyBatch(b *testing.B) {
+	signedReports := generateSignedReports(b, benchmarkVerifyReports)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if failed := tcn.VerifyBatch(signedReports, 0); len(failed) != 0 {
+			b.Fatal("Verification failed")
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// configKey is the context key of the resolved tenant's configuration.
+	configKey = "config"
+	// tenantHeader is the gRPC metadata key selecting the tenant of a call.
+	// Calls without it are resolved by their authority.
+	tenantHeader = "x-ito-tenant"
+
+	unknownTenantError = "Unknown tenant"
+)
+
+// tenantIDPattern restricts tenant IDs to strings that are safe in route
+// prefixes and hostnames.
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// tenantSettings are the settings of a tenant in the tenant file. Unset
+// settings are taken from the server's flags.
+type tenantSettings struct {
+	ID        string   `json:"id"`
+	Hostnames []string `json:"hostnames"`
+	MemoTypes []string `json:"memo_types"`
+	Regions   []string `json:"regions"`
+	// ClientCertSubjects are the common names of the client certificates
+	// that may use the federation and admin routes of the tenant.
+	ClientCertSubjects []string `json:"client_cert_subjects"`
+	// VerificationIssuers are the base64 encoded public keys of the issuers
+	// of verification tokens, and SigningKey is the file with the key that
+	// signs report downloads. Tenants must not share keys, so unlike the
+	// other settings, they aren't taken from the server's flags.
+	VerificationIssuers []string `json:"verification_issuers"`
+	SigningKey          string   `json:"signing_key"`
+}
+
+// tenants maps tenant IDs and hostnames to the configuration of the tenant.
+type tenants struct {
+	byID   map[string]*Config
+	byHost map[string]*Config
+}
+
+// loadTenants reads the tenant file at path. The configuration of each tenant
+// is a copy of base with the settings of the file applied.
+func loadTenants(path string, base *Config) (*tenants, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var settings []*tenantSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("Failed to parse tenant file: %s", err.Error())
+	}
+	return newTenants(settings, base)
+}
+
+func newTenants(settings []*tenantSettings, base *Config) (*tenants, error) {
+	if len(settings) == 0 {
+		return nil, errors.New("Tenant file contains no tenants")
+	}
+
+	t := &tenants{
+		byID:   map[string]*Config{},
+		byHost: map[string]*Config{},
+	}
+	// signingKeys maps the public keys of the tenants' signing keys to the
+	// tenant IDs.
+	signingKeys := map[string]string{}
+	for _, s := range settings {
+		if !tenantIDPattern.MatchString(s.ID) {
+			return nil, fmt.Errorf("Invalid tenant ID: %q", s.ID)
+		}
+		if _, ok := t.byID[s.ID]; ok {
+			return nil, fmt.Errorf("Duplicate tenant ID: %s", s.ID)
+		}
+
+		config := *base
+		config.TenantID = s.ID
+		if len(s.MemoTypes) > 0 {
+			memoTypes, err := parseMemoTypes(s.MemoTypes)
+			if err != nil {
+				return nil, fmt.Errorf("Tenant %s: %s", s.ID, err.Error())
+			}
+			if len(memoTypes) == 0 {
+				return nil, fmt.Errorf("Tenant %s: At least one memo type must be accepted", s.ID)
+			}
+			config.MemoTypes = memoTypes
+		}
+		if len(s.Regions) > 0 {
+			config.Regions = parseRegions(s.Regions)
+		}
+		config.ClientCertSubjects = s.ClientCertSubjects
+
+		issuers, err := parseVerificationIssuers(s.VerificationIssuers)
+		if err != nil {
+			return nil, fmt.Errorf("Tenant %s: %s", s.ID, err.Error())
+		}
+		config.VerificationIssuers = issuers
+		config.SigningKey = nil
+		if s.SigningKey != "" {
+			key, err := readSigningKey(s.SigningKey)
+			if err != nil {
+				return nil, fmt.Errorf("Tenant %s: %s", s.ID, err.Error())
+			}
+			public := string(key.Public().(ed25519.PublicKey))
+			if other, ok := signingKeys[public]; ok {
+				return nil, fmt.Errorf("Tenants %s and %s use the same signing key", other, s.ID)
+			}
+			signingKeys[public] = s.ID
+			config.SigningKey = key
+		}
+		t.byID[s.ID] = &config
+
+		for _, host := range s.Hostnames {
+			if _, ok := t.byHost[host]; ok {
+				return nil, fmt.Errorf("Hostname %s is used by several tenants", host)
+			}
+			t.byHost[host] = &config
+		}
+	}
+	return t, nil
+}
+
+// resolve returns the configuration of the tenant given by the route prefix
+// or, if there's none, the hostname of the request.
+func (t *tenants) resolve(c *gin.Context) (*Config, bool) {
+	return t.lookup(c.Param("tenant"), c.Request.Host)
+}
+
+// lookup returns the configuration of the tenant with the given ID or, if id
+// is empty, of the tenant serving host. host may contain a port.
+func (t *tenants) lookup(id, host string) (*Config, bool) {
+	if id != "" {
+		config, ok := t.byID[id]
+		return config, ok
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	config, ok := t.byHost[host]
+	return config, ok
+}
+
+// resolveTenant returns a middleware that determines the tenant of every
+// request. If t is nil, all requests belong to the default tenant. Otherwise
+// requests that don't belong to a tenant are rejected.
+func resolveTenant(t *tenants) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if t == nil {
+			return
+		}
+		config, ok := t.resolve(c)
+		if !ok {
+			respondError(c, http.StatusNotFound, unknownTenantError)
+			c.Abort()
+			return
+		}
+		c.Set(configKey, config)
+	}
+}
+
+// configFor returns the configuration of the tenant of c.
+func (h *TCNReportHandler) configFor(c *gin.Context) *Config {
+	if config, ok := c.Get(configKey); ok {
+		return config.(*Config)
+	}
+	return h.config
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ito-org/go-backend/tcn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTenants(t *testing.T) {
+	base := DefaultConfig()
+	base.Regions = []string{"by"}
+
+	tenants, err := newTenants([]*tenantSettings{
+		{ID: "rki", Hostnames: []string{"rki.example.org"}},
+		{ID: "bag", Hostnames: []string{"bag.example.org"}, MemoTypes: []string{"0x0,0x2"}, Regions: []string{"be,zh"}},
+	}, base)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rki, ok := tenants.byID["rki"]
+	assert.True(t, ok)
+	assert.Equal(t, "rki", rki.TenantID)
+	assert.Equal(t, base.MemoTypes, rki.MemoTypes)
+	assert.Equal(t, base.Regions, rki.Regions)
+
+	bag, ok := tenants.byID["bag"]
+	assert.True(t, ok)
+	assert.Equal(t, "bag", bag.TenantID)
+	assert.Equal(t, []uint8{tcn.CoEpiMemoCode, tcn.ITOMemoCode}, bag.MemoTypes)
+	assert.Equal(t, []string{"be", "zh"}, bag.Regions)
+
+	// The base configuration isn't changed.
+	assert.Equal(t, "", base.TenantID)
+	assert.Equal(t, []string{"by"}, base.Regions)
+
+	for _, tc := range []struct {
+		id, host string
+		expected *Config
+	}{
+		{"rki", "", rki},
+		{"bag", "rki.example.org", bag},
+		{"", "rki.example.org", rki},
+		{"", "bag.example.org:8080", bag},
+		{"", "other.example.org", nil},
+		{"other", "rki.example.org", nil},
+	} {
+		config, ok := tenants.lookup(tc.id, tc.host)
+		assert.Equal(t, tc.expected != nil, ok, tc.id+" "+tc.host)
+		assert.Equal(t, tc.expected, config, tc.id+" "+tc.host)
+	}
+}
+
+func TestNewTenantsInvalid(t *testing.T) {
+	for _, settings := range [][]*tenantSettings{
+		{},
+		{{ID: ""}},
+		{{ID: "../rki"}},
+		{{ID: "rki"}, {ID: "rki"}},
+		{{ID: "rki", Hostnames: []string{"example.org"}}, {ID: "bag", Hostnames: []string{"example.org"}}},
+		{{ID: "rki", MemoTypes: []string{"0x7"}}},
+		{{ID: "rki", MemoTypes: []string{","}}},
+	} {
+		_, err := newTenants(settings, DefaultConfig())
+		assert.Error(t, err)
+	}
+}
+
+func TestNewTenantsKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tenant-keys")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	writeKey := func(name string) (string, ed25519.PrivateKey) {
+		_, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		seed := base64.StdEncoding.EncodeToString(priv.Seed())
+		if err := ioutil.WriteFile(path, []byte(seed+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path, priv
+	}
+	rkiKey, rkiPriv := writeKey("rki")
+	bagKey, bagPriv := writeKey("bag")
+	issuer, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	issuerB64 := base64.StdEncoding.EncodeToString(issuer)
+
+	// Keys aren't inherited from the base configuration.
+	base := DefaultConfig()
+	base.SigningKey = rkiPriv
+	base.VerificationIssuers = []ed25519.PublicKey{issuer}
+
+	tenants, err := newTenants([]*tenantSettings{
+		{ID: "rki", SigningKey: rkiKey, VerificationIssuers: []string{issuerB64}},
+		{ID: "bag", SigningKey: bagKey},
+		{ID: "who"},
+	}, base)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, rkiPriv, tenants.byID["rki"].SigningKey)
+	assert.Equal(t, []ed25519.PublicKey{issuer}, tenants.byID["rki"].VerificationIssuers)
+	assert.Equal(t, bagPriv, tenants.byID["bag"].SigningKey)
+	assert.Empty(t, tenants.byID["bag"].VerificationIssuers)
+	assert.Nil(t, tenants.byID["who"].SigningKey)
+
+	for _, settings := range [][]*tenantSettings{
+		{{ID: "rki", SigningKey: rkiKey}, {ID: "bag", SigningKey: rkiKey}},
+		{{ID: "rki", SigningKey: filepath.Join(dir, "missing")}},
+		{{ID: "rki", VerificationIssuers: []string{"not a key"}}},
+		{{ID: "rki", VerificationIssuers: []string{base64.StdEncoding.EncodeToString([]byte("short"))}}},
+	} {
+		_, err := newTenants(settings, DefaultConfig())
+		assert.Error(t, err)
+	}
+}
+
+func TestResolveTenant(t *testing.T) {
+	tenants, err := newTenants([]*tenantSettings{
+		{ID: "rki", Hostnames: []string{"rki.example.org"}},
+	}, DefaultConfig())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	h := &TCNReportHandler{config: DefaultConfig()}
+	tenantOf := func(c *gin.Context) {
+		c.String(http.StatusOK, h.configFor(c).TenantID)
+	}
+
+	r := gin.New()
+	r.Use(resolveTenant(tenants))
+	r.GET("/tenant", tenantOf)
+	r.GET("/t/:tenant/tenant", tenantOf)
+
+	for _, tc := range []struct {
+		host, path string
+		code       int
+		body       string
+	}{
+		{"rki.example.org", "/tenant", http.StatusOK, "rki"},
+		{"localhost", "/t/rki/tenant", http.StatusOK, "rki"},
+		{"localhost", "/tenant", http.StatusNotFound, unknownTenantError},
+		{"rki.example.org", "/t/bag/tenant", http.StatusNotFound, unknownTenantError},
+	} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tc.path, nil)
+		req.Host = tc.host
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, tc.code, rec.Code, tc.host+tc.path)
+		assert.Equal(t, tc.body, rec.Body.String(), tc.host+tc.path)
+	}
+
+	// Without tenants, requests belong to the default tenant.
+	r = gin.New()
+	r.Use(resolveTenant(nil))
+	r.GET("/tenant", tenantOf)
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/tenant", nil)
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "", rec.Body.String())
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	clientCertRequiredError   = "Valid client certificate required"
+	clientCertNotAllowedError = "Client certificate not allowed for tenant"
+)
+
+// certReloader holds the server's TLS certificate and reloads it from disk
+// whenever the process receives SIGHUP, so certificates can be rotated
+// without restarting the server.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertReloader loads the certificate/key pair and starts listening for
+// SIGHUP.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	go func() {
+		for range sigs {
+			if err := cr.reload(); err != nil {
+				fmt.Printf("Failed to reload TLS certificate: %s\n", err.Error())
+				continue
+			}
+			fmt.Println("Reloaded TLS certificate")
+		}
+	}()
+
+	return cr, nil
+}
+
+// reload reads the certificate/key pair from disk. The previous certificate
+// stays in use if loading fails.
+func (cr *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.mu.Unlock()
+	return nil
+}
+
+// GetCertificate implements the tls.Config callback of the same name.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// newTLSConfig creates the TLS configuration for the server. If clientCAFile
+// is set, client certificates signed by that CA are verified when presented.
+// They are not required for the public endpoints; see requireClientCert.
+func newTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cr, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cr.GetCertificate,
+	}
+
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificates found in client CA file")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
+
+// requireClientCert is a middleware that rejects all requests that weren't
+// made over TLS with a client certificate verified against the configured
+// client CA. The client CA is shared by all tenants, so requests to a tenant
+// are also rejected unless the certificate is one of the tenant's (see
+// Config.ClientCertSubjects).
+func requireClientCert() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			c.String(http.StatusForbidden, clientCertRequiredError)
+			c.Abort()
+			return
+		}
+		if config, ok := c.Get(configKey); ok && !config.(*Config).acceptsClientCert(c.Request.TLS.VerifiedChains) {
+			c.String(http.StatusForbidden, clientCertNotAllowedError)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
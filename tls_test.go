@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCert writes a self-signed certificate/key pair for commonName to
+// dir and returns the file paths.
+func writeTestCert(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ito-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeTestCert(t, dir, "first")
+	cr, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestCert(t, dir, "second")
+	assert.NoError(t, cr.reload())
+
+	cert, err := cr.GetCertificate(nil)
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "second", leaf.Subject.CommonName)
+}
+
+func TestRequireClientCert(t *testing.T) {
+	r := gin.New()
+	r.GET("/", requireClientCert(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{}}}
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestRequireClientCertTenant(t *testing.T) {
+	tenants, err := newTenants([]*tenantSettings{
+		{ID: "tenant-a", ClientCertSubjects: []string{"peer-a"}},
+		{ID: "tenant-b", ClientCertSubjects: []string{"peer-b"}},
+		{ID: "tenant-c"},
+	}, DefaultConfig())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	router, err := GetRouter("8080", nil, DefaultConfig(), tenants)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	certA := &x509.Certificate{Subject: pkix.Name{CommonName: "peer-a"}}
+	for _, tc := range []struct {
+		method, path string
+	}{
+		{"POST", "/t/tenant-b/federation/tcnreport"},
+		{"POST", "/t/tenant-b/federation/tcnreport/batch"},
+		{"GET", "/t/tenant-b/federation/tcnreport"},
+		{"GET", "/t/tenant-b/admin/tcnreport"},
+		// Tenants without client certificate subjects accept none.
+		{"GET", "/t/tenant-c/admin/tcnreport"},
+	} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certA}}}
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code, tc.path)
+		assert.Equal(t, clientCertNotAllowedError, rec.Body.String(), tc.path)
+	}
+
+	// Only the tenant of the certificate accepts it.
+	r := gin.New()
+	r.Use(resolveTenant(tenants))
+	r.GET("/t/:tenant/admin", requireClientCert(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	for _, tc := range []struct {
+		tenantID string
+		expected int
+	}{
+		{"tenant-a", http.StatusOK},
+		{"tenant-b", http.StatusForbidden},
+		{"tenant-c", http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/t/"+tc.tenantID+"/admin", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certA}}}
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, tc.expected, rec.Code, tc.tenantID)
+	}
+}